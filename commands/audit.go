@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+	"github.com/mitchellh/cli"
+	flag "github.com/spf13/pflag"
+)
+
+type AuditCommand struct {
+	UI cli.Ui
+}
+
+func (c *AuditCommand) Run(args []string) int {
+	var project string
+	var jsonOutput bool
+	opts := &globalOptions{}
+
+	f := flag.NewFlagSet("audit", flag.ExitOnError)
+	opts.addFlags(f)
+	opts.addOrganizationFlags(f)
+	f.StringVar(&project, "project", "", "Audit all the workspaces in the project, instead of the workspace of the root path")
+	f.BoolVar(&jsonOutput, "json", false, "Output the result in JSON")
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	ctx, cancel := opts.context()
+	defer cancel()
+
+	ws, err := InitCLI(ctx, opts)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	policy, err := loadPolicy(opts.root, opts.policyFile)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	workspaces := []*updater.Workspace{ws}
+	if project != "" {
+		if workspaces, err = ws.ListWorkspaces(ctx, project); err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+	} else if err = requireRootWorkspace(ws, "--project"); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	results := make([]*updater.AuditResult, len(workspaces))
+	for i, w := range workspaces {
+		results[i] = w.Audit(ctx, policy)
+	}
+
+	if jsonOutput {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+		c.UI.Output(string(out))
+	} else {
+		c.outputResults(results)
+	}
+
+	return auditExitCode(results)
+}
+
+func (c *AuditCommand) outputResults(results []*updater.AuditResult) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKSPACE\tVERSION\tRESOLVED\tLATEST\tDEFAULT\tSTATUS")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Workspace, r.Version, orDash(r.ResolvedVersion), orDash(r.LatestVersion), orDash(r.DefaultVersion), r.Status)
+	}
+	w.Flush()
+	c.UI.Output(strings.TrimSpace(buf.String()))
+
+	for _, r := range results {
+		if r.Error != "" {
+			c.UI.Error(fmt.Sprintf("%s: %s", r.Workspace, r.Error))
+		}
+	}
+}
+
+// auditExitCode returns 3 if any workspace violates the policy, 1 if any workspace can't be audited, or 0
+func auditExitCode(results []*updater.AuditResult) int {
+	exitCode := 0
+	for _, r := range results {
+		switch r.Status {
+		case updater.AuditPolicyViolation:
+			exitCode = 3
+		case updater.AuditUnknownVersion, updater.AuditError:
+			if exitCode == 0 {
+				exitCode = 1
+			}
+		}
+	}
+	return exitCode
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func (c *AuditCommand) Help() string {
+	return strings.TrimSpace(helpMessageAudit)
+}
+
+func (c *AuditCommand) Synopsis() string {
+	return "Audit Terraform versions of workspaces"
+}
+
+const helpMessageAudit = `
+Usage: terraform-cloud-updater audit [OPTION]
+
+Notes:
+  Each workspace is reported as one of the following statuses.
+    ok:               the latest version compatible with the required version is used
+    outdated:         a newer version compatible with the required version is available
+    policy_violation: the version is not the default version of the policy file
+    unknown_version:  the version of the workspace can't be parsed
+    error:            the workspace can't be audited
+  Exit code is 3 if any workspace violates the policy, and 1 if any workspace can't be audited.
+
+Options:
+` + helpMessageGlobalOptions + `
+` + helpMessageOrganizationOptions + `
+  --project                Audit all the workspaces in the project, instead of the workspace of the root path
+  --json                   Output the result in JSON
+`
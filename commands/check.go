@@ -1,10 +1,11 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"strings"
 
+	"github.com/chroju/terraform-cloud-updater/updater"
 	"github.com/mitchellh/cli"
 	flag "github.com/spf13/pflag"
 )
@@ -14,57 +15,141 @@ type CheckCommand struct {
 }
 
 func (c *CheckCommand) Run(args []string) int {
-	var root, token string
+	opts := &globalOptions{}
+	notifyOpts := &notifyOptions{}
 
-	currentDir, _ := os.Getwd()
 	f := flag.NewFlagSet("check", flag.ExitOnError)
-	f.StringVar(&token, "token", "", "Terraform Cloud token")
-	f.StringVar(&root, "root-path", currentDir, "Terraform config root path (default: current directory)")
+	opts.addFlags(f)
+	notifyOpts.addFlags(f)
 	if err := f.Parse(args); err != nil {
 		c.UI.Error(err.Error())
 		return 1
 	}
 
-	ws, err := InitCLI(root, token)
+	notifications, err := notifyOpts.notifications(opts)
 	if err != nil {
 		c.UI.Error(err.Error())
 		return 1
 	}
 
-	currentVer, err := ws.GetCurrentVersion()
+	ctx, cancel := opts.context()
+	defer cancel()
+
+	ws, err := InitCLI(ctx, opts)
 	if err != nil {
 		c.UI.Error(err.Error())
 		return 1
 	}
 
-	latestVer, err := ws.GetLatestVersion()
+	policy, err := loadPolicy(opts.root, opts.policyFile)
 	if err != nil {
 		c.UI.Error(err.Error())
 		return 1
 	}
 
-	compatibleVer, err := ws.GetCompatibleLatestVersion()
+	currentWsVer, err := ws.GetWorkspaceVersion(ctx)
+	if isUnknownVersion(err) {
+		c.UI.Error(fmt.Sprintf("Current version is unknown: %s", err))
+		if latestVer, err := ws.GetLatestVersion(ctx); err == nil {
+			c.UI.Info(fmt.Sprintf("Found: unknown -> %s", latestVer.String()))
+		}
+		c.UI.Info(fmt.Sprintf("\nLink to: %s", ws.GetSettingsLink()))
+		return 1
+	} else if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	currentVer, err := ws.ResolveWorkspaceVersion(ctx, currentWsVer)
 	if err != nil {
 		c.UI.Error(err.Error())
 		return 1
 	}
+	if !currentWsVer.IsPinned() {
+		c.UI.Warn(fmt.Sprintf("Workspace version %s currently resolves to %s", currentWsVer, currentVer))
+	}
+
+	latestVer, err := ws.GetLatestVersion(ctx)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	compatibleVer, err := ws.GetCompatibleLatestVersion(ctx)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	stateVer, err := ws.GetStateVersion(ctx)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if stateVer != nil {
+		c.UI.Warn(fmt.Sprintf("Current state was written by Terraform %s", stateVer.String()))
+		if currentVer.Compare(stateVer) < 0 {
+			c.UI.Error(fmt.Sprintf("Current version %s is older than the state version %s", currentVer.String(), stateVer.String()))
+		}
+	}
 
 	if currentVer.String() != latestVer.String() {
 		c.UI.Warn("New version is available.")
+		event := &updater.NotificationEvent{
+			Kind:           updater.NotifyAvailable,
+			Organization:   ws.GetOrganization(),
+			Workspace:      ws.GetName(),
+			CurrentVersion: describeVersion(currentWsVer, currentVer),
+			NewVersion:     latestVer.String(),
+			Link:           ws.GetSettingsLink(),
+		}
 		if compatibleVer.String() != latestVer.String() {
 			c.UI.Error("This version is not compatible with required version.")
-			c.UI.Info(fmt.Sprintf("Found: %s -> %s (WARN: required version is %s)", currentVer.String(), latestVer.String(), ws.GetRequiredVersions().String()))
+			c.UI.Info(fmt.Sprintf("Found: %s -> %s (WARN: required version is %s)", describeVersion(currentWsVer, currentVer), latestVer.String(), ws.GetRequiredVersions().String()))
+			outputRequiredVersionSources(c.UI, ws.GetRequiredVersions())
+			event.Detail = fmt.Sprintf("not compatible with required version %s", ws.GetRequiredVersions().String())
 		} else {
-			c.UI.Info(fmt.Sprintf("Found: %s -> %s", currentVer.String(), latestVer.String()))
+			c.UI.Info(fmt.Sprintf("Found: %s -> %s", describeVersion(currentWsVer, currentVer), latestVer.String()))
 		}
 		c.UI.Info(fmt.Sprintf("\nLink to: %s", ws.GetSettingsLink()))
+		sendNotifications(ctx, c.UI, notifications, []*updater.NotificationEvent{event})
 	} else {
 		c.UI.Warn("No updates available.")
 	}
 
+	if err = ws.CheckPolicy(ctx, policy); err != nil {
+		c.UI.Error(err.Error())
+		if _, ok := err.(*updater.PolicyViolation); ok {
+			return 3
+		}
+		return 1
+	}
+
 	return 0
 }
 
+// isUnknownVersion returns whether the error is because terraform version of the workspace can't be parsed
+func isUnknownVersion(err error) bool {
+	var parseErr *updater.VersionParseError
+	return errors.As(err, &parseErr)
+}
+
+// describeVersion returns the workspace version with the version it resolves to, like "~> 0.12.0 (0.12.29)"
+func describeVersion(v *updater.WorkspaceVersion, resolved *updater.SemanticVersion) string {
+	if v.IsPinned() || resolved == nil {
+		return v.String()
+	}
+	return fmt.Sprintf("%s (%s)", v, resolved)
+}
+
+// outputRequiredVersionSources outputs where each required version constraint is declared
+func outputRequiredVersionSources(ui cli.Ui, rvs *updater.RequiredVersions) {
+	for _, rv := range *rvs {
+		if rv.Source != "" {
+			ui.Info(fmt.Sprintf("  %s (%s)", rv.String(), rv.Source))
+		}
+	}
+}
+
 func (c *CheckCommand) Help() string {
 	return strings.TrimSpace(helpMessageCheck)
 }
@@ -76,6 +161,12 @@ func (c *CheckCommand) Synopsis() string {
 const helpMessageCheck = `
 Usage: terraform-cloud-updater check [OPTION]
 
---token        Terraform Cloud token        (default: TFE_TOKEN env var or parse from your .terraformrc)
---root-path    Terraform config root path   (default: current directory)
+Notes:
+  If the policy file defines the default version of the project or the variable set of the workspace,
+  check fails with exit code 3 when the workspace has another version.
+  With --notify, a notification is sent when a new version is available.
+
+Options:
+` + helpMessageGlobalOptions + `
+` + helpMessageNotifyOptions + `
 `
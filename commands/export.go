@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+	"github.com/mitchellh/cli"
+	flag "github.com/spf13/pflag"
+)
+
+type ExportReleasesCommand struct {
+	UI cli.Ui
+}
+
+func (c *ExportReleasesCommand) Run(args []string) int {
+	var output string
+	opts := &globalOptions{}
+
+	// Terraform config and token are not needed to export releases
+	f := flag.NewFlagSet("export-releases", flag.ExitOnError)
+	f.StringVar(&output, "output", "", "Path to write the releases (default: stdout)")
+	f.DurationVar(&opts.timeout, "timeout", 0, "Timeout of the whole command (default: no timeout)")
+	f.IntVar(&opts.maxRetries, "max-retries", updater.DefaultMaxAttempts-1, "Max retries of each API call on rate limits and transient errors")
+	f.BoolVar(&opts.noCache, "no-cache", false, "Don't use the cached Terraform releases")
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	ctx, cancel := opts.context()
+	defer cancel()
+
+	releases, err := newTfReleases(opts, updater.NewHTTPClient(opts.maxRetries+1)).List(ctx)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if err = updater.WriteTfReleases(w, releases); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if output != "" {
+		c.UI.Warn(fmt.Sprintf("Exported %d releases to %s", len(releases), output))
+	}
+	return 0
+}
+
+func (c *ExportReleasesCommand) Help() string {
+	return strings.TrimSpace(helpMessageExportReleases)
+}
+
+func (c *ExportReleasesCommand) Synopsis() string {
+	return "Export Terraform releases to the file for --releases-file"
+}
+
+const helpMessageExportReleases = `
+Usage: terraform-cloud-updater export-releases [OPTION]
+
+Notes:
+  Run this on a machine connected to GitHub, and bring the file to the offline machine.
+  All the releases are exported, following every page of the GitHub API.
+  Then the file can be used with --releases-file of the other commands.
+
+Options:
+  --output                 Path to write the releases   (default: stdout)
+  --timeout                Timeout of the whole command, like 5m   (default: no timeout)
+  --max-retries            Max retries of each API call on rate limits and transient errors   (default: 4)
+  --no-cache               Don't use the cached Terraform releases   (default: cached in $XDG_CACHE_HOME for 1h)
+`
@@ -1,8 +1,11 @@
 package commands
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,15 +15,18 @@ import (
 	hcl "github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
 	"github.com/hashicorp/hcl/v2/hclparse"
-	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 )
 
 type cliConfig struct {
-	Token           string
-	Hostname        string
-	Organization    string
-	Workspace       string
-	RequiredVersion string
+	Token            string
+	Hostname         string
+	Organization     string
+	Workspace        string
+	RequiredVersion  string
+	RootModule       string
+	RequiredVersions updater.RequiredVersions
 }
 
 type tfRc struct {
@@ -32,23 +38,42 @@ type credential struct {
 	Token string `hcl:"token"`
 }
 
-// InitCLI initialize CLI config and creates a new workspace
-func InitCLI(root, token string) (*updater.Workspace, error) {
-	config, err := parseTfFiles(root)
+// InitCLI initialize CLI config and creates a new workspace.
+// ctx bounds the connection to Terraform Cloud, so that --timeout and signals stop a hung startup.
+func InitCLI(ctx context.Context, opts *globalOptions) (*updater.Workspace, error) {
+	config, err := parseTfFiles(opts.root, opts.ignoreParseErrors)
+	if err == errRemoteBackendNotFound && opts.organization != "" {
+		// the workspaces in the organization are listed without the workspace of the root path
+		config, err = &cliConfig{Token: readToken()}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if token != "" {
-		config.Token = token
+	if opts.organization != "" {
+		config.Organization = opts.organization
+	}
+	if opts.hostname != "" {
+		config.Hostname = opts.hostname
+	}
+
+	if opts.token != "" {
+		config.Token = opts.token
 	}
 
-	tfc, err := updater.NewTfCloud(config.Hostname, config.Token)
+	httpClient := updater.NewHTTPClient(opts.maxRetries + 1)
+	tfc, err := updater.NewTfCloud(ctx, config.Hostname, config.Token, httpClient)
 	if err != nil {
 		return nil, err
 	}
 
-	ws, err := updater.NewWorkspace(tfc, &updater.Config{Organization: config.Organization, Workspace: config.Workspace, RequiredVersion: config.RequiredVersion})
+	ws, err := updater.NewWorkspace(tfc, &updater.Config{
+		Hostname:         config.Hostname,
+		Organization:     config.Organization,
+		Workspace:        config.Workspace,
+		RequiredVersions: config.RequiredVersions,
+		Releases:         newTfReleases(opts, httpClient),
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -56,12 +81,51 @@ func InitCLI(root, token string) (*updater.Workspace, error) {
 	return ws, nil
 }
 
-func parseTfFiles(root string) (*cliConfig, error) {
-	config, err := parseTfRemoteBackend(root)
+// newTfReleases returns the source of Terraform releases by the options, with the releases announced to serve
+func newTfReleases(opts *globalOptions, httpClient *http.Client) updater.TfReleases {
+	releases := newTfReleasesSource(opts, httpClient)
+	if len(opts.announced) > 0 {
+		return updater.NewAnnouncedTfReleases(releases, opts.announced)
+	}
+	return releases
+}
+
+func newTfReleasesSource(opts *globalOptions, httpClient *http.Client) updater.TfReleases {
+	ttl := updater.DefaultReleaseCacheTTL
+	if opts.revalidate {
+		ttl = 0
+	}
+	cache := updater.NewReleaseCache(updater.DefaultReleaseCachePath(), ttl)
+	switch {
+	case opts.releasesFile != "":
+		return updater.NewFileTfReleases(opts.releasesFile)
+	case opts.offline:
+		return updater.NewCachedTfReleases(cache)
+	case opts.noCache:
+		return updater.NewTfReleases(httpClient, nil)
+	}
+	return updater.NewTfReleases(httpClient, cache)
+}
+
+// requireRootWorkspace returns an error if the workspace of the root path is not known, which happens only with --organization
+func requireRootWorkspace(ws *updater.Workspace, targetFlag string) error {
+	if ws.GetName() == "" {
+		return fmt.Errorf("%s. Specify %s to target the workspaces in %s", errRemoteBackendNotFound, targetFlag, ws.GetOrganization())
+	}
+	return nil
+}
+
+func parseTfFiles(root string, ignoreParseErrors bool) (*cliConfig, error) {
+	config, err := parseTfRemoteBackend(root, ignoreParseErrors)
 	if err != nil {
 		return nil, err
 	}
+	config.Token = readToken()
+	return config, nil
+}
 
+// readToken reads the token from TFE_TOKEN, or the .terraformrc
+func readToken() string {
 	token := os.Getenv("TFE_TOKEN")
 	if token == "" {
 		home := os.Getenv("HOME")
@@ -70,47 +134,87 @@ func parseTfFiles(root string) (*cliConfig, error) {
 		}
 		token, _ = parseTerraformrc(home + "/.terraformrc")
 	}
-	config.Token = token
+	return token
+}
 
-	return config, nil
+var errRemoteBackendNotFound = errors.New("Remote backend config is not found")
+
+var terraformFileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "terraform"},
+	},
+}
+
+var terraformBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "required_version"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "backend", LabelNames: []string{"type"}},
+		{Type: "cloud"},
+	},
+}
+
+var remoteBackendSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "hostname"},
+		{Name: "organization"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "workspaces"},
+	},
+}
+
+var workspacesSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "name"},
+		{Name: "prefix"},
+		{Name: "tags"},
+	},
 }
 
-func parseTfRemoteBackend(root string) (*cliConfig, error) {
+// diagnosticsError renders HCL diagnostics with source snippets, in the same way as Terraform does
+type diagnosticsError struct {
+	diags hcl.Diagnostics
+	files map[string]*hcl.File
+}
+
+func (e *diagnosticsError) Error() string {
+	var buf bytes.Buffer
+	wr := hcl.NewDiagnosticTextWriter(&buf, e.files, 0, false)
+	if err := wr.WriteDiagnostics(e.diags); err != nil {
+		return e.diags.Error()
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// parseTfRemoteBackend walks all .tf and .tf.json files under the root and collects the diagnostics of every file.
+// If ignoreParseErrors is true, parse errors in files which don't contain the terraform block are ignored.
+func parseTfRemoteBackend(root string, ignoreParseErrors bool) (*cliConfig, error) {
 	var config *cliConfig
+	var diags hcl.Diagnostics
+	parser := hclparse.NewParser()
 	err := filepath.Walk(root,
 		func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
 
-			if info.IsDir() || !strings.HasSuffix(info.Name(), ".tf") {
+			if info.IsDir() || !isConfigFile(info.Name()) {
 				return nil
 			}
 
-			src, err := ioutil.ReadFile(path)
-			if err != nil {
-				return err
-			}
-
-			file, diags := hclwrite.ParseConfig(src, path, hcl.InitialPos)
-			if diags.HasErrors() {
-				return diags
+			file, parseDiags := parseConfigFile(parser, path, ignoreParseErrors)
+			diags = append(diags, parseDiags...)
+			if file == nil {
+				return nil
 			}
 
-			for _, block := range file.Body().Blocks() {
-				if block.Type() == "terraform" {
-					for _, subBlock := range block.Body().Blocks() {
-						if subBlock.Type() == "backend" && subBlock.Labels()[0] == "remote" {
-							subBlockBody := subBlock.Body()
-							config = &cliConfig{
-								Organization:    parseAttribute(subBlockBody.GetAttribute("organization")),
-								Hostname:        parseAttribute(subBlockBody.GetAttribute("hostname")),
-								Workspace:       parseAttribute(subBlockBody.Blocks()[0].Body().GetAttribute("name")),
-								RequiredVersion: parseAttribute(block.Body().GetAttribute("required_version")),
-							}
-						}
-					}
-				}
+			c, moreDiags := decodeRemoteBackend(file.Body)
+			diags = append(diags, moreDiags...)
+			if c != nil && !moreDiags.HasErrors() {
+				c.RootModule = filepath.Dir(path)
+				config = c
 			}
 			return nil
 		})
@@ -119,13 +223,135 @@ func parseTfRemoteBackend(root string) (*cliConfig, error) {
 		return nil, err
 	}
 
-	if config == nil {
-		return nil, fmt.Errorf("Remote backend config is not found")
+	if config == nil && !diags.HasErrors() {
+		return nil, errRemoteBackendNotFound
+	}
+
+	if config != nil {
+		rvs, moreDiags := loadRequiredVersions(parser, config.RootModule, ignoreParseErrors, map[string]bool{})
+		diags = append(diags, moreDiags...)
+		config.RequiredVersions = rvs
+	}
+
+	if diags.HasErrors() {
+		return nil, &diagnosticsError{diags: diags, files: parser.Files()}
 	}
 
 	return config, nil
 }
 
+func isConfigFile(name string) bool {
+	return strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json")
+}
+
+// parseConfigFile parses the native syntax or JSON syntax file.
+// It returns nil file when the file has errors, and the errors are ignored if ignoreParseErrors is true and the file doesn't contain the terraform block.
+func parseConfigFile(parser *hclparse.Parser, path string, ignoreParseErrors bool) (*hcl.File, hcl.Diagnostics) {
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasSuffix(path, ".tf.json") {
+		file, diags = parser.ParseJSONFile(path)
+	} else {
+		file, diags = parser.ParseHCLFile(path)
+	}
+
+	if diags.HasErrors() {
+		if ignoreParseErrors && !hasTerraformBlock(file) {
+			return nil, nil
+		}
+		return nil, diags
+	}
+	return file, diags
+}
+
+// hasTerraformBlock reports whether the (possibly partially parsed) file contains the terraform block
+func hasTerraformBlock(file *hcl.File) bool {
+	if file == nil || file.Body == nil {
+		return false
+	}
+	content, _, _ := file.Body.PartialContent(terraformFileSchema)
+	return content != nil && len(content.Blocks) > 0
+}
+
+// decodeRemoteBackend decodes the remote backend or the cloud block settings in the terraform block.
+// The body may come from either a native syntax file or a JSON syntax file.
+func decodeRemoteBackend(body hcl.Body) (*cliConfig, hcl.Diagnostics) {
+	var config *cliConfig
+	content, _, diags := body.PartialContent(terraformFileSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	for _, block := range content.Blocks {
+		tfContent, _, moreDiags := block.Body.PartialContent(terraformBlockSchema)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+
+		for _, b := range tfContent.Blocks {
+			if b.Type == "backend" && b.Labels[0] != "remote" {
+				continue
+			}
+
+			c, moreDiags := decodeRemoteSettings(b)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+
+			c.RequiredVersion, moreDiags = evalStringAttribute(tfContent.Attributes["required_version"])
+			diags = append(diags, moreDiags...)
+
+			config = c
+		}
+	}
+
+	return config, diags
+}
+
+// decodeRemoteSettings decodes the `backend "remote"` or the `cloud` block, which have the same arguments
+func decodeRemoteSettings(block *hcl.Block) (*cliConfig, hcl.Diagnostics) {
+	c := &cliConfig{}
+	content, _, diags := block.Body.PartialContent(remoteBackendSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var moreDiags hcl.Diagnostics
+	c.Hostname, moreDiags = evalStringAttribute(content.Attributes["hostname"])
+	diags = append(diags, moreDiags...)
+	c.Organization, moreDiags = evalStringAttribute(content.Attributes["organization"])
+	diags = append(diags, moreDiags...)
+
+	if len(content.Blocks) == 0 {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing workspaces block",
+			Detail:   fmt.Sprintf("The %s block must have a workspaces block with a name argument.", block.Type),
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+	workspaces := content.Blocks[0]
+	wsContent, _, moreDiags := workspaces.Body.PartialContent(workspacesSchema)
+	diags = append(diags, moreDiags...)
+	if moreDiags.HasErrors() {
+		return nil, diags
+	}
+	if _, ok := wsContent.Attributes["name"]; !ok {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported workspaces block",
+			Detail:   "Only a single workspace specified by the name argument is supported.",
+			Subject:  workspaces.DefRange.Ptr(),
+		})
+	}
+	c.Workspace, moreDiags = evalStringAttribute(wsContent.Attributes["name"])
+	diags = append(diags, moreDiags...)
+
+	return c, diags
+}
+
 func parseTerraformrc(path string) (string, error) {
 	parser := hclparse.NewParser()
 	f, diags := parser.ParseHCLFile(path)
@@ -140,9 +366,30 @@ func parseTerraformrc(path string) (string, error) {
 	return tfrc.Credentials[0].Token, nil
 }
 
-func parseAttribute(a *hclwrite.Attribute) string {
-	if a == nil {
-		return ""
+// evalStringAttribute evaluates the attribute expression without any variables or functions,
+// so that only literal values, heredocs and interpolation-free templates are accepted.
+// A nil EvalContext makes the JSON syntax return the templates as they are, so an empty one is given.
+func evalStringAttribute(attr *hcl.Attribute) (string, hcl.Diagnostics) {
+	if attr == nil {
+		return "", nil
 	}
-	return string(a.Expr().BuildTokens(nil)[1].Bytes)
+
+	val, diags := attr.Expr.Value(&hcl.EvalContext{})
+	if diags.HasErrors() {
+		return "", diags
+	}
+
+	val, err := convert.Convert(val, cty.String)
+	if err != nil || val.IsNull() || !val.IsWhollyKnown() {
+		return "", hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported argument value",
+				Detail:   fmt.Sprintf("The %q argument must be a literal string.", attr.Name),
+				Subject:  attr.Expr.Range().Ptr(),
+			},
+		}
+	}
+
+	return strings.TrimSpace(val.AsString()), nil
 }
@@ -0,0 +1,340 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+func TestDecodeRemoteBackend(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected *cliConfig
+		errorMsg string
+	}{
+		{
+			src: `
+terraform {
+  backend "remote" {
+    hostname     = "app.terraform.io"
+    organization = "chroju"
+
+    workspaces {
+      name = "sample"
+    }
+  }
+  required_version = "> 0.12.0, <= 0.12.24"
+}`,
+			expected: &cliConfig{
+				Hostname:        "app.terraform.io",
+				Organization:    "chroju",
+				Workspace:       "sample",
+				RequiredVersion: "> 0.12.0, <= 0.12.24",
+			},
+		},
+		{
+			src: `
+terraform {
+  required_version = "${"~> 0.12"}"
+  backend "remote" {
+    organization = <<EOT
+chroju
+EOT
+
+    workspaces {
+      name = "sample"
+    }
+  }
+}`,
+			expected: &cliConfig{
+				Organization:    "chroju",
+				Workspace:       "sample",
+				RequiredVersion: "~> 0.12",
+			},
+		},
+		{
+			src: `
+terraform {
+  required_version = "~> 1.1"
+  cloud {
+    organization = "chroju"
+
+    workspaces {
+      name = "sample"
+    }
+  }
+}`,
+			expected: &cliConfig{
+				Organization:    "chroju",
+				Workspace:       "sample",
+				RequiredVersion: "~> 1.1",
+			},
+		},
+		{
+			src: `
+terraform {
+  backend "s3" {
+    bucket = "sample"
+  }
+}`,
+			expected: nil,
+		},
+		{
+			src: `
+terraform {
+  backend "remote" {
+    organization = "chroju"
+
+    workspaces {
+      name = "${var.workspace}"
+    }
+  }
+}`,
+			errorMsg: "main.tf:7,17-20: Variables not allowed",
+		},
+		{
+			src: `
+terraform {
+  backend "remote" {
+    organization = ["chroju"]
+
+    workspaces {
+      prefix = "sample-"
+    }
+  }
+}`,
+			errorMsg: "main.tf:4,20-30: Unsupported argument value",
+		},
+	}
+
+	for _, v := range cases {
+		file, diags := hclparse.NewParser().ParseHCL([]byte(v.src), "main.tf")
+		if diags.HasErrors() {
+			t.Fatalf("Failed to parse: %s", diags.Error())
+		}
+
+		got, diags := decodeRemoteBackend(file.Body)
+		if v.errorMsg != "" {
+			if !strings.Contains(diags.Error(), v.errorMsg) {
+				t.Errorf("Failed: src = %s / want error = %s / got = %s", v.src, v.errorMsg, diags.Error())
+			}
+			continue
+		}
+		if diags.HasErrors() {
+			t.Errorf("Failed of error: %s / src = %s", diags.Error(), v.src)
+		} else if !reflect.DeepEqual(got, v.expected) {
+			t.Errorf("Failed: src = %s / want = %+v / got = %+v", v.src, v.expected, got)
+		}
+	}
+}
+
+func TestDecodeRemoteBackendJSON(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected *cliConfig
+		errorMsg string
+	}{
+		{
+			src: `{
+  "terraform": {
+    "backend": {
+      "remote": {
+        "hostname": "app.terraform.io",
+        "organization": "chroju",
+        "workspaces": {
+          "name": "sample"
+        }
+      }
+    },
+    "required_version": "> 0.12.0, <= 0.12.24"
+  }
+}`,
+			expected: &cliConfig{
+				Hostname:        "app.terraform.io",
+				Organization:    "chroju",
+				Workspace:       "sample",
+				RequiredVersion: "> 0.12.0, <= 0.12.24",
+			},
+		},
+		{
+			src: `{
+  "terraform": [
+    {
+      "cloud": {
+        "organization": "chroju",
+        "workspaces": {
+          "name": "sample"
+        }
+      }
+    },
+    {
+      "required_providers": {
+        "null": {
+          "source": "hashicorp/null"
+        }
+      }
+    }
+  ]
+}`,
+			expected: &cliConfig{
+				Organization: "chroju",
+				Workspace:    "sample",
+			},
+		},
+		{
+			src: `{
+  "terraform": {
+    "backend": {
+      "remote": {
+        "organization": "${var.organization}",
+        "workspaces": {
+          "name": "sample"
+        }
+      }
+    }
+  }
+}`,
+			errorMsg: "main.tf.json:5,28-31: Variables not allowed",
+		},
+	}
+
+	for _, v := range cases {
+		file, diags := hclparse.NewParser().ParseJSON([]byte(v.src), "main.tf.json")
+		if diags.HasErrors() {
+			t.Fatalf("Failed to parse: %s", diags.Error())
+		}
+
+		got, diags := decodeRemoteBackend(file.Body)
+		if v.errorMsg != "" {
+			if !strings.Contains(diags.Error(), v.errorMsg) {
+				t.Errorf("Failed: src = %s / want error = %s / got = %s", v.src, v.errorMsg, diags.Error())
+			}
+			continue
+		}
+		if diags.HasErrors() {
+			t.Errorf("Failed of error: %s / src = %s", diags.Error(), v.src)
+		} else if !reflect.DeepEqual(got, v.expected) {
+			t.Errorf("Failed: src = %s / want = %+v / got = %+v", v.src, v.expected, got)
+		}
+	}
+}
+
+func TestParseTfRemoteBackendIgnoreParseErrors(t *testing.T) {
+	root, err := ioutil.TempDir("", "tfc-updater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"backend.tf": `
+terraform {
+  backend "remote" {
+    organization = "chroju"
+    workspaces {
+      name = "sample"
+    }
+  }
+}`,
+		"examples/broken.tf": `
+resource "null_resource" "sample" {
+  triggers =
+}`,
+	}
+	for name, src := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = parseTfRemoteBackend(root, false)
+	if err == nil {
+		t.Fatalf("Failed: want parse error of examples/broken.tf")
+	}
+	for _, want := range []string{"Error: Invalid expression", "broken.tf line 3", "3:   triggers ="} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Failed: want = %s / got = %s", want, err.Error())
+		}
+	}
+
+	config, err := parseTfRemoteBackend(root, true)
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err.Error())
+	}
+	if config.Workspace != "sample" {
+		t.Errorf("Failed: want = sample / got = %s", config.Workspace)
+	}
+}
+
+func TestLoadRequiredVersions(t *testing.T) {
+	root, err := ioutil.TempDir("", "tfc-updater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"main.tf": `
+terraform {
+  required_version = ">= 0.12.0"
+}
+
+module "network" {
+  source = "./modules/network"
+}
+
+module "remote" {
+  source = "terraform-aws-modules/vpc/aws"
+}`,
+		"versions.tf.json": `{"terraform": {"required_version": "< 0.13.0"}}`,
+		"modules/network/main.tf": `
+terraform {
+  required_version = "~> 0.12.20"
+}
+
+module "parent" {
+  source = "../../"
+}`,
+		"unused/main.tf": `
+terraform {
+  required_version = "= 0.11.14"
+}`,
+	}
+	for name, src := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rvs, diags := loadRequiredVersions(hclparse.NewParser(), root, false, map[string]bool{})
+	if diags.HasErrors() {
+		t.Fatalf("Failed of error: %s", diags.Error())
+	}
+
+	expected := map[string]string{
+		">= 0.12.0":  filepath.Join(root, "main.tf") + ":3",
+		"< 0.13.0":   filepath.Join(root, "versions.tf.json") + ":1",
+		"~> 0.12.20": filepath.Join(root, "modules/network/main.tf") + ":3",
+	}
+	if len(rvs) != len(expected) {
+		t.Fatalf("Failed: want = %v / got = %s", expected, rvs.String())
+	}
+	for _, rv := range rvs {
+		if source, ok := expected[rv.String()]; !ok || source != rv.Source {
+			t.Errorf("Failed: constraint = %s / want source = %s / got source = %s", rv.String(), source, rv.Source)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metricsRegistry holds the metrics of serve, and writes them in the Prometheus text format.
+// It is written by hand, so that the tool doesn't depend on the Prometheus client library.
+type metricsRegistry struct {
+	mu       sync.Mutex
+	families []*metricFamily
+}
+
+// metricFamily is a counter or a gauge, with the values for each label set
+type metricFamily struct {
+	registry *metricsRegistry
+	name     string
+	help     string
+	kind     string
+	values   map[string]float64
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{}
+}
+
+func (r *metricsRegistry) counter(name, help string) *metricFamily {
+	return r.register(name, help, "counter")
+}
+
+func (r *metricsRegistry) gauge(name, help string) *metricFamily {
+	return r.register(name, help, "gauge")
+}
+
+func (r *metricsRegistry) register(name, help, kind string) *metricFamily {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := &metricFamily{registry: r, name: name, help: help, kind: kind, values: map[string]float64{}}
+	r.families = append(r.families, f)
+	return f
+}
+
+// add adds v to the value with the labels, which are given as name and value pairs
+func (f *metricFamily) add(v float64, labels ...string) {
+	f.registry.mu.Lock()
+	defer f.registry.mu.Unlock()
+	f.values[formatLabels(labels)] += v
+}
+
+// set sets v to the value with the labels, which are given as name and value pairs
+func (f *metricFamily) set(v float64, labels ...string) {
+	f.registry.mu.Lock()
+	defer f.registry.mu.Unlock()
+	f.values[formatLabels(labels)] = v
+}
+
+// reset removes all the values, so that the label sets which don't exist anymore are not exposed
+func (f *metricFamily) reset() {
+	f.registry.mu.Lock()
+	defer f.registry.mu.Unlock()
+	f.values = map[string]float64{}
+}
+
+// writeTo writes all the metrics in the Prometheus text format
+func (r *metricsRegistry) writeTo(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, f := range r.families {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(f.values))
+		for k := range f.values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", f.name, k, strconv.FormatFloat(f.values[k], 'f', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelValueReplacer.Replace(labels[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+	"github.com/mitchellh/cli"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	r := newMetricsRegistry()
+	counter := r.counter("test_total", "Test counter.")
+	gauge := r.gauge("test_gauge", "Test gauge.")
+	counter.add(1, "workspace", "network")
+	counter.add(2, "workspace", "network")
+	counter.add(1, "workspace", `a"b\c`)
+	gauge.set(5)
+	gauge.set(1.5)
+
+	expected := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{workspace="a\"b\\c"} 1
+test_total{workspace="network"} 3
+# HELP test_gauge Test gauge.
+# TYPE test_gauge gauge
+test_gauge 1.5
+`
+	var buf strings.Builder
+	if err := r.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("Failed: want = %s / got = %s", expected, buf.String())
+	}
+
+	gauge.reset()
+	buf.Reset()
+	r.writeTo(&buf)
+	if strings.Contains(buf.String(), "test_gauge 1.5") {
+		t.Errorf("Failed: want no value after reset / got = %s", buf.String())
+	}
+}
+
+func TestRecordDrift(t *testing.T) {
+	s := newServer(cli.NewMockUi(), &serveOptions{interval: 15 * time.Minute})
+	s.recordDrift([]*updater.DriftResult{
+		{Organization: "chroju", Workspace: "network", Version: "1.5.6", LatestVersion: "1.6.1", MinorsBehind: 1, PatchesBehind: 1, Compatible: true},
+		{Organization: "chroju", Workspace: "broken", Error: "not found"},
+	})
+	// the workspaces which don't exist anymore are not exposed
+	s.recordDrift([]*updater.DriftResult{
+		{Organization: "chroju", Workspace: "sample", Version: "0.14.0", LatestVersion: "1.6.1", MajorsBehind: 1, MinorsBehind: 4},
+	})
+
+	var buf strings.Builder
+	if err := s.metrics.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	for _, expected := range []string{
+		`tfc_workspace_terraform_version_info{organization="chroju",workspace="sample",version="0.14.0"} 1`,
+		`tfc_workspace_versions_behind{organization="chroju",workspace="sample",level="major"} 1`,
+		`tfc_workspace_versions_behind{organization="chroju",workspace="sample",level="minor"} 4`,
+		`tfc_workspace_versions_behind{organization="chroju",workspace="sample",level="patch"} 0`,
+		`tfc_workspace_version_compatible{organization="chroju",workspace="sample"} 0`,
+		`tfc_updater_updates_total{result="failure"} 0`,
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("Failed: want = %s / got = %s", expected, got)
+		}
+	}
+	for _, unexpected := range []string{`workspace="network"`, `workspace="broken"`} {
+		if strings.Contains(got, unexpected) {
+			t.Errorf("Failed: want no %s / got = %s", unexpected, got)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+
+	hcl "github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+var moduleFileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "terraform"},
+		{Type: "module", LabelNames: []string{"name"}},
+	},
+}
+
+var moduleBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "source", Required: true},
+	},
+}
+
+// loadRequiredVersions collects all required_version constraints in the module directory,
+// and in the local modules called from it, as `terraform init` does.
+// Each constraint records the file and line where it is declared.
+func loadRequiredVersions(parser *hclparse.Parser, dir string, ignoreParseErrors bool, visited map[string]bool) (updater.RequiredVersions, hcl.Diagnostics) {
+	var rvs updater.RequiredVersions
+	var diags hcl.Diagnostics
+
+	dir = filepath.Clean(dir)
+	if visited[dir] {
+		return nil, nil
+	}
+	visited[dir] = true
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read module directory",
+				Detail:   fmt.Sprintf("Module directory %s could not be read: %s", dir, err),
+			},
+		}
+	}
+
+	for _, info := range infos {
+		if info.IsDir() || !isConfigFile(info.Name()) {
+			continue
+		}
+
+		file, moreDiags := parseConfigFile(parser, filepath.Join(dir, info.Name()), ignoreParseErrors)
+		diags = append(diags, moreDiags...)
+		if file == nil {
+			continue
+		}
+
+		content, _, moreDiags := file.Body.PartialContent(moduleFileSchema)
+		diags = append(diags, moreDiags...)
+
+		for _, block := range content.Blocks {
+			switch block.Type {
+			case "terraform":
+				tfContent, _, moreDiags := block.Body.PartialContent(terraformBlockSchema)
+				diags = append(diags, moreDiags...)
+				attr, ok := tfContent.Attributes["required_version"]
+				if !ok {
+					continue
+				}
+				constraints, moreDiags := evalRequiredVersions(attr)
+				diags = append(diags, moreDiags...)
+				rvs = append(rvs, constraints...)
+
+			case "module":
+				moduleContent, _, moreDiags := block.Body.PartialContent(moduleBlockSchema)
+				diags = append(diags, moreDiags...)
+				if moreDiags.HasErrors() {
+					continue
+				}
+				source, moreDiags := evalStringAttribute(moduleContent.Attributes["source"])
+				diags = append(diags, moreDiags...)
+				if !isLocalModuleSource(source) {
+					continue
+				}
+				constraints, moreDiags := loadRequiredVersions(parser, filepath.Join(dir, source), ignoreParseErrors, visited)
+				diags = append(diags, moreDiags...)
+				rvs = append(rvs, constraints...)
+			}
+		}
+	}
+
+	return rvs, diags
+}
+
+func evalRequiredVersions(attr *hcl.Attribute) (updater.RequiredVersions, hcl.Diagnostics) {
+	value, diags := evalStringAttribute(attr)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	rvs, err := updater.NewRequiredVersions(value)
+	if err != nil {
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid required_version",
+				Detail:   fmt.Sprintf("The required_version %q could not be parsed: %s", value, err),
+				Subject:  attr.Expr.Range().Ptr(),
+			},
+		}
+	}
+
+	source := fmt.Sprintf("%s:%d", attr.Range.Filename, attr.Range.Start.Line)
+	for _, rv := range rvs {
+		rv.Source = source
+	}
+	return rvs, nil
+}
+
+// isLocalModuleSource reports whether the module source is a local path.
+// Remote modules are not downloaded, so their constraints are out of scope.
+func isLocalModuleSource(source string) bool {
+	return strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")
+}
@@ -0,0 +1,215 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+	"github.com/mitchellh/cli"
+	flag "github.com/spf13/pflag"
+)
+
+// globalOptions are the options which all commands accept
+type globalOptions struct {
+	root              string
+	token             string
+	ignoreParseErrors bool
+	timeout           time.Duration
+	maxRetries        int
+	noCache           bool
+	offline           bool
+	releasesFile      string
+	policyFile        string
+	organization      string
+	hostname          string
+	// revalidate revalidates the cached releases even if they are fresh. It is not a flag, but set by serve on webhooks.
+	revalidate bool
+	// announced are the releases announced by the new version webhook of serve, which GitHub may not list yet
+	announced []*updater.TfRelease
+}
+
+func (o *globalOptions) addFlags(f *flag.FlagSet) {
+	currentDir, _ := os.Getwd()
+	f.StringVar(&o.token, "token", "", "Terraform Cloud token")
+	f.StringVar(&o.root, "root-path", currentDir, "Terraform config root path (default: current directory)")
+	f.BoolVar(&o.ignoreParseErrors, "ignore-parse-errors", false, "Ignore parse errors in files without the terraform block")
+	f.DurationVar(&o.timeout, "timeout", 0, "Timeout of the whole command (default: no timeout)")
+	f.BoolVar(&o.noCache, "no-cache", false, "Don't use the cached Terraform releases")
+	f.BoolVar(&o.offline, "offline", false, "Read Terraform releases only from the cache, without access to GitHub")
+	f.StringVar(&o.releasesFile, "releases-file", "", "Read Terraform releases from the JSON file written by export-releases")
+	f.StringVar(&o.policyFile, "policy-file", "", "Path to the policy file (default: .tfc-updater.hcl in the root path)")
+	f.IntVar(&o.maxRetries, "max-retries", updater.DefaultMaxAttempts-1, "Max retries of each API call on rate limits and transient errors")
+}
+
+// addOrganizationFlags adds the flags for the commands which target the workspaces in the organization,
+// so that they can run without the remote backend config in the root path.
+func (o *globalOptions) addOrganizationFlags(f *flag.FlagSet) {
+	f.StringVar(&o.organization, "organization", "", "Organization of the workspaces (default: the one of the remote backend config)")
+	f.StringVar(&o.hostname, "hostname", "", "Hostname of Terraform Cloud or Enterprise (default: the one of the remote backend config)")
+}
+
+// context returns the context which is canceled by the timeout, SIGINT or SIGTERM
+func (o *globalOptions) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if o.timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, o.timeout)
+		cancelParent := cancel
+		cancel = func() {
+			cancelTimeout()
+			cancelParent()
+		}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigCh:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigCh)
+	}()
+
+	return ctx, cancel
+}
+
+// changeOptions are the options of the commands which change the workspace version
+type changeOptions struct {
+	journalPath    string
+	onBusy         string
+	busyTimeout    time.Duration
+	force          bool
+	ignoreSchedule bool
+}
+
+func (o *changeOptions) addFlags(f *flag.FlagSet) {
+	f.StringVar(&o.journalPath, "journal", updater.DefaultJournalPath(), "Path to the journal of version changes")
+	f.StringVar(&o.onBusy, "on-busy", "abort", "How to handle the workspace which is locked or has an active run (abort, wait or lock)")
+	f.DurationVar(&o.busyTimeout, "busy-timeout", 10*time.Minute, "Timeout to wait for the workspace to be idle")
+	f.BoolVar(&o.force, "force", false, "Allow the version older than the one which wrote the current state")
+	f.BoolVar(&o.ignoreSchedule, "ignore-schedule", false, "Change the workspace even outside of the maintenance windows or in a freeze")
+}
+
+// apply applies the options to the workspace.
+// The maintenance windows and the freezes in the policy file gate the changes, unless --ignore-schedule is set.
+func (o *changeOptions) apply(ws *updater.Workspace, global *globalOptions) error {
+	busyPolicy, err := updater.NewBusyPolicy(o.onBusy)
+	if err != nil {
+		return fmt.Errorf("--on-busy %s", err)
+	}
+
+	ws.SetJournal(updater.NewFileJournal(o.journalPath))
+	ws.SetBusyPolicy(busyPolicy, o.busyTimeout)
+	ws.SetAllowDowngrade(o.force)
+
+	if !o.ignoreSchedule {
+		policy, err := loadPolicy(global.root, global.policyFile)
+		if err != nil {
+			return err
+		}
+		ws.SetSchedule(policy)
+	}
+	return nil
+}
+
+// notifyOptions are the options to notify the version changes to Slack, Microsoft Teams or webhooks
+type notifyOptions struct {
+	notify         []string
+	templatePath   string
+	groupThreshold int
+}
+
+func (o *notifyOptions) addFlags(f *flag.FlagSet) {
+	f.StringArrayVar(&o.notify, "notify", nil, "Send notifications to <slack|teams|webhook>=<URL>, which can be repeated")
+	f.StringVar(&o.templatePath, "notify-template", "", "Path to the text/template file of the notification message")
+	f.IntVar(&o.groupThreshold, "notify-group", updater.DefaultNotifyGroupThreshold, "Group the notifications into one message if more workspaces are involved")
+}
+
+// notifications returns the notifications of the options, or nil if no notifier is given.
+// The notifiers in TFC_UPDATER_NOTIFY separated by spaces are used without --notify, so that the URLs are kept out of the command line.
+func (o *notifyOptions) notifications(global *globalOptions) (*updater.Notifications, error) {
+	specs := o.notify
+	if len(specs) == 0 {
+		specs = strings.Fields(os.Getenv("TFC_UPDATER_NOTIFY"))
+	}
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	httpClient := updater.NewHTTPClient(global.maxRetries + 1)
+	notifiers := make([]updater.Notifier, 0, len(specs))
+	for _, spec := range specs {
+		kv := strings.SplitN(spec, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("--notify must be <slack|teams|webhook>=<URL>, but got %s", spec)
+		}
+		notifier, err := updater.NewNotifier(kv[0], kv[1], httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("--notify %s", err)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+
+	var tmpl string
+	if o.templatePath != "" {
+		b, err := ioutil.ReadFile(o.templatePath)
+		if err != nil {
+			return nil, err
+		}
+		tmpl = string(b)
+	}
+	return updater.NewNotifications(notifiers, tmpl, o.groupThreshold)
+}
+
+// sendNotifications sends the events. Failing to notify is reported, but doesn't fail the command.
+func sendNotifications(ctx context.Context, ui cli.Ui, n *updater.Notifications, events []*updater.NotificationEvent) {
+	if n == nil {
+		return
+	}
+	if err := n.Send(ctx, events); err != nil {
+		ui.Error(fmt.Sprintf("Failed to notify: %s", err))
+	}
+}
+
+// reportUntouched reports the workspace was not changed, when the command is canceled or timed out
+func reportUntouched(ctx context.Context, ui cli.Ui, ws *updater.Workspace) {
+	if ctx.Err() == nil {
+		return
+	}
+	ui.Error(fmt.Sprintf("Aborted (%s): workspace %s/%s was left untouched", ctx.Err(), ws.GetOrganization(), ws.GetName()))
+}
+
+const helpMessageGlobalOptions = `  --token                  Terraform Cloud token        (default: TFE_TOKEN env var or parse from your .terraformrc)
+  --root-path              Terraform config root path   (default: current directory)
+  --ignore-parse-errors    Ignore parse errors in files without the terraform block
+  --timeout                Timeout of the whole command, like 5m   (default: no timeout)
+  --no-cache               Don't use the cached Terraform releases   (default: cached in $XDG_CACHE_HOME for 1h)
+  --offline                Read Terraform releases only from the cache, even if it is expired
+  --releases-file          Read Terraform releases from the JSON file written by export-releases
+  --policy-file            Path to the policy file   (default: .tfc-updater.hcl in the root path, if exists)
+  --max-retries            Max retries of each API call on rate limits and transient errors   (default: 4)`
+
+const helpMessageOrganizationOptions = `  --organization           Organization of the workspaces   (default: the one of the remote backend config)
+                           With this, the remote backend config is not needed to target the workspaces by --project
+  --hostname               Hostname of Terraform Cloud or Enterprise   (default: the one of the remote backend config)`
+
+const helpMessageNotifyOptions = `  --notify                 Send notifications to <slack|teams|webhook>=<URL>, which can be repeated
+                           (default: TFC_UPDATER_NOTIFY env var, separated by spaces)
+  --notify-template        Path to the text/template file of the notification message
+  --notify-group           Group the notifications into one message if more workspaces are involved   (default: 3)`
+
+const helpMessageChangeOptions = `  --journal                Path to the journal of version changes   (default: $XDG_DATA_HOME/terraform-cloud-updater/journal.json)
+  --on-busy                How to handle the workspace which is locked or has an active run   (default: abort)
+                           abort: abort the change, wait: wait until the workspace is idle,
+                           lock: wait until the active run finishes and lock the workspace during the change
+  --busy-timeout           Timeout to wait for the workspace to be idle   (default: 10m)
+  --force                  Allow the version older than the one which wrote the current state
+  --ignore-schedule        Change the workspace even outside of the maintenance windows or in a freeze of the policy file`
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+	"github.com/mitchellh/cli"
+)
+
+func TestNotifyOptions(t *testing.T) {
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, r.URL.Path+" "+string(body))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	templatePath := filepath.Join(dir, "template.txt")
+	if err := ioutil.WriteFile(templatePath, []byte(`{{range .Groups}}{{range .Events}}{{.Workspace}} {{.Link}}{{end}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		opts     *notifyOptions
+		env      string
+		expected []string
+		errorMsg string
+	}{
+		{opts: &notifyOptions{}},
+		{
+			opts:     &notifyOptions{notify: []string{"slack=" + ts.URL + "/slack", "webhook=" + ts.URL + "/webhook"}, templatePath: templatePath, groupThreshold: 3},
+			expected: []string{`/slack {"text":"network https://app.terraform.io/app/chroju/workspaces/network/settings/general"}`, `/webhook {"title":"terraform-cloud-updater: chroju/network"`},
+		},
+		{
+			opts:     &notifyOptions{groupThreshold: 3},
+			env:      "teams=" + ts.URL + "/teams",
+			expected: []string{`/teams {"@context":"https://schema.org/extensions","@type":"MessageCard"`},
+		},
+		{opts: &notifyOptions{notify: []string{ts.URL}}, errorMsg: "--notify must be <slack|teams|webhook>=<URL>"},
+		{opts: &notifyOptions{notify: []string{"discord=" + ts.URL}}, errorMsg: "unknown notifier"},
+	}
+
+	for _, v := range cases {
+		bodies = nil
+		os.Setenv("TFC_UPDATER_NOTIFY", v.env)
+		n, err := v.opts.notifications(&globalOptions{})
+		if v.errorMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), v.errorMsg) {
+				t.Errorf("Failed: opts = %+v / want = %s / got = %v", v.opts, v.errorMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed: opts = %+v / want no error / got = %s", v.opts, err)
+			continue
+		}
+
+		sendNotifications(context.Background(), cli.NewMockUi(), n, []*updater.NotificationEvent{{
+			Kind:           updater.NotifyUpdated,
+			Organization:   "chroju",
+			Workspace:      "network",
+			CurrentVersion: "1.5.6",
+			NewVersion:     "1.6.0",
+			Link:           "https://app.terraform.io/app/chroju/workspaces/network/settings/general",
+		}})
+		if len(bodies) != len(v.expected) {
+			t.Errorf("Failed: opts = %+v / want = %q / got = %q", v.opts, v.expected, bodies)
+			continue
+		}
+		for i := range bodies {
+			if !strings.HasPrefix(bodies[i], v.expected[i]) {
+				t.Errorf("Failed: opts = %+v / want = %s / got = %s", v.opts, v.expected[i], bodies[i])
+			}
+		}
+	}
+	os.Unsetenv("TFC_UPDATER_NOTIFY")
+}
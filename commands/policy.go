@@ -0,0 +1,543 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+
+	hcl "github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// defaultPolicyFile is the policy file name searched in the root path
+const defaultPolicyFile = ".tfc-updater.hcl"
+
+var policyFileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{
+			Type:       "project",
+			LabelNames: []string{"name"},
+		},
+		{
+			Type:       "variable_set",
+			LabelNames: []string{"name"},
+		},
+		{
+			Type:       "rule",
+			LabelNames: []string{"name"},
+		},
+		{
+			Type:       "exception",
+			LabelNames: []string{"workspace"},
+		},
+		{
+			Type:       "maintenance_window",
+			LabelNames: []string{"name"},
+		},
+		{
+			Type:       "freeze",
+			LabelNames: []string{"name"},
+		},
+	},
+}
+
+var scopePolicySchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{
+			Name: "default_version",
+		},
+	},
+}
+
+var ruleSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "workspaces"},
+		{Name: "tags"},
+		{Name: "version"},
+		{Name: "update"},
+		{Name: "cooldown"},
+	},
+}
+
+var exceptionSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "version", Required: true},
+		{Name: "expires", Required: true},
+		{Name: "reason"},
+	},
+}
+
+var maintenanceWindowSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "workspaces"},
+		{Name: "tags"},
+		{Name: "days"},
+		{Name: "start", Required: true},
+		{Name: "end", Required: true},
+		{Name: "time_zone"},
+	},
+}
+
+var freezeSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "workspaces"},
+		{Name: "tags"},
+		{Name: "start", Required: true},
+		{Name: "end", Required: true},
+		{Name: "time_zone"},
+		{Name: "reason"},
+	},
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// loadPolicy loads the policy file.
+// If path is empty, .tfc-updater.hcl in the root path is loaded, and nil is returned if it doesn't exist.
+func loadPolicy(root, path string) (*updater.Policy, error) {
+	if path == "" {
+		path = filepath.Join(root, defaultPolicyFile)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+
+	parser := hclparse.NewParser()
+	file, diags := parser.ParseHCLFile(path)
+	if diags.HasErrors() {
+		return nil, &diagnosticsError{diags: diags, files: parser.Files()}
+	}
+
+	policy, diags := decodePolicy(file.Body)
+	if diags.HasErrors() {
+		return nil, &diagnosticsError{diags: diags, files: parser.Files()}
+	}
+	return policy, nil
+}
+
+func decodePolicy(body hcl.Body) (*updater.Policy, hcl.Diagnostics) {
+	content, diags := body.Content(policyFileSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	policy := &updater.Policy{}
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "rule":
+			rule, ruleDiags := decodeRule(block)
+			diags = append(diags, ruleDiags...)
+			if rule != nil {
+				policy.Rules = append(policy.Rules, rule)
+			}
+			continue
+		case "exception":
+			exception, exceptionDiags := decodeException(block)
+			diags = append(diags, exceptionDiags...)
+			if exception != nil {
+				policy.Exceptions = append(policy.Exceptions, exception)
+			}
+			continue
+		case "maintenance_window":
+			window, windowDiags := decodeMaintenanceWindow(block)
+			diags = append(diags, windowDiags...)
+			if window != nil {
+				policy.Windows = append(policy.Windows, window)
+			}
+			continue
+		case "freeze":
+			freeze, freezeDiags := decodeFreeze(block)
+			diags = append(diags, freezeDiags...)
+			if freeze != nil {
+				policy.Freezes = append(policy.Freezes, freeze)
+			}
+			continue
+		}
+
+		sp, scopeDiags := decodeScopePolicy(block)
+		diags = append(diags, scopeDiags...)
+		if sp == nil {
+			continue
+		}
+
+		switch block.Type {
+		case "project":
+			policy.Projects = append(policy.Projects, sp)
+		case "variable_set":
+			policy.VariableSets = append(policy.VariableSets, sp)
+		}
+	}
+	return policy, diags
+}
+
+func decodeScopePolicy(block *hcl.Block) (*updater.ScopePolicy, hcl.Diagnostics) {
+	content, diags := block.Body.Content(scopePolicySchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	sp := &updater.ScopePolicy{
+		Kind:   block.Type,
+		Name:   block.Labels[0],
+		Source: fmt.Sprintf("%s:%d", block.DefRange.Filename, block.DefRange.Start.Line),
+	}
+
+	defaultVersion, diags := evalVersionAttribute(content.Attributes["default_version"])
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	sp.DefaultVersion = defaultVersion
+	return sp, nil
+}
+
+func decodeRule(block *hcl.Block) (*updater.Rule, hcl.Diagnostics) {
+	content, diags := block.Body.Content(ruleSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	rule := &updater.Rule{
+		Name:   block.Labels[0],
+		Source: fmt.Sprintf("%s:%d", block.DefRange.Filename, block.DefRange.Start.Line),
+	}
+
+	var attrDiags hcl.Diagnostics
+	rule.Workspaces, attrDiags = evalStringListAttribute(content.Attributes["workspaces"])
+	diags = append(diags, attrDiags...)
+	rule.Tags, attrDiags = evalStringListAttribute(content.Attributes["tags"])
+	diags = append(diags, attrDiags...)
+	rule.Version, attrDiags = evalVersionAttribute(content.Attributes["version"])
+	diags = append(diags, attrDiags...)
+
+	updateAttr := content.Attributes["update"]
+	rule.Update, attrDiags = evalStringAttribute(updateAttr)
+	diags = append(diags, attrDiags...)
+	switch rule.Update {
+	case "", updater.UpdatePatch, updater.UpdateMinor, updater.UpdateMajor:
+	default:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid update",
+			Detail:   fmt.Sprintf("Unknown update strategy %q. It must be \"patch\", \"minor\" or \"major\".", rule.Update),
+			Subject:  updateAttr.Expr.Range().Ptr(),
+		})
+	}
+
+	cooldownAttr := content.Attributes["cooldown"]
+	cooldown, attrDiags := evalStringAttribute(cooldownAttr)
+	diags = append(diags, attrDiags...)
+	if cooldown != "" {
+		d, err := parseCooldown(cooldown)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid cooldown",
+				Detail:   fmt.Sprintf("%s. It must be a number of days like \"14d\", or a duration like \"12h\".", err),
+				Subject:  cooldownAttr.Expr.Range().Ptr(),
+			})
+		}
+		rule.Cooldown = d
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	switch {
+	case rule.Version == nil && rule.Update == "":
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing version or update",
+			Detail:   fmt.Sprintf("Rule %q must have either \"version\" or \"update\".", rule.Name),
+			Subject:  block.DefRange.Ptr(),
+		})
+	case rule.Version != nil && rule.Update != "":
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Conflicting version and update",
+			Detail:   fmt.Sprintf("Rule %q can't have both \"version\" and \"update\".", rule.Name),
+			Subject:  block.DefRange.Ptr(),
+		})
+	case rule.Cooldown > 0 && rule.Update == "":
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported cooldown",
+			Detail:   fmt.Sprintf("Rule %q can have \"cooldown\" only with \"update\".", rule.Name),
+			Subject:  cooldownAttr.Expr.Range().Ptr(),
+		})
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return rule, diags
+}
+
+func decodeException(block *hcl.Block) (*updater.Exception, hcl.Diagnostics) {
+	content, diags := block.Body.Content(exceptionSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	exception := &updater.Exception{
+		Workspace: block.Labels[0],
+		Source:    fmt.Sprintf("%s:%d", block.DefRange.Filename, block.DefRange.Start.Line),
+	}
+
+	var attrDiags hcl.Diagnostics
+	exception.Version, attrDiags = evalVersionAttribute(content.Attributes["version"])
+	diags = append(diags, attrDiags...)
+	exception.Reason, attrDiags = evalStringAttribute(content.Attributes["reason"])
+	diags = append(diags, attrDiags...)
+
+	expiresAttr := content.Attributes["expires"]
+	expires, attrDiags := evalStringAttribute(expiresAttr)
+	diags = append(diags, attrDiags...)
+	if !attrDiags.HasErrors() {
+		t, err := time.Parse("2006-01-02", expires)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid expires",
+				Detail:   fmt.Sprintf("%q is not a date. It must be like \"2006-01-02\".", expires),
+				Subject:  expiresAttr.Expr.Range().Ptr(),
+			})
+		}
+		exception.Expires = t
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return exception, diags
+}
+
+func decodeMaintenanceWindow(block *hcl.Block) (*updater.MaintenanceWindow, hcl.Diagnostics) {
+	content, diags := block.Body.Content(maintenanceWindowSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	window := &updater.MaintenanceWindow{
+		Name:   block.Labels[0],
+		Source: fmt.Sprintf("%s:%d", block.DefRange.Filename, block.DefRange.Start.Line),
+	}
+
+	var attrDiags hcl.Diagnostics
+	window.Workspaces, attrDiags = evalStringListAttribute(content.Attributes["workspaces"])
+	diags = append(diags, attrDiags...)
+	window.Tags, attrDiags = evalStringListAttribute(content.Attributes["tags"])
+	diags = append(diags, attrDiags...)
+	window.Location, attrDiags = evalTimeZoneAttribute(content.Attributes["time_zone"])
+	diags = append(diags, attrDiags...)
+	window.Start, attrDiags = evalClockAttribute(content.Attributes["start"])
+	diags = append(diags, attrDiags...)
+	window.End, attrDiags = evalClockAttribute(content.Attributes["end"])
+	diags = append(diags, attrDiags...)
+
+	daysAttr := content.Attributes["days"]
+	days, attrDiags := evalStringListAttribute(daysAttr)
+	diags = append(diags, attrDiags...)
+	for _, d := range days {
+		wd, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid days",
+				Detail:   fmt.Sprintf("Unknown day %q. It must be one of \"mon\", \"tue\", \"wed\", \"thu\", \"fri\", \"sat\" and \"sun\".", d),
+				Subject:  daysAttr.Expr.Range().Ptr(),
+			})
+			continue
+		}
+		window.Days = append(window.Days, wd)
+	}
+
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if window.Start == window.End {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Empty maintenance window",
+			Detail:   fmt.Sprintf("Maintenance window %q must end at another time than it starts.", window.Name),
+			Subject:  content.Attributes["end"].Expr.Range().Ptr(),
+		})
+	}
+	return window, diags
+}
+
+func decodeFreeze(block *hcl.Block) (*updater.Freeze, hcl.Diagnostics) {
+	content, diags := block.Body.Content(freezeSchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	freeze := &updater.Freeze{
+		Name:   block.Labels[0],
+		Source: fmt.Sprintf("%s:%d", block.DefRange.Filename, block.DefRange.Start.Line),
+	}
+
+	var attrDiags hcl.Diagnostics
+	freeze.Workspaces, attrDiags = evalStringListAttribute(content.Attributes["workspaces"])
+	diags = append(diags, attrDiags...)
+	freeze.Tags, attrDiags = evalStringListAttribute(content.Attributes["tags"])
+	diags = append(diags, attrDiags...)
+	freeze.Reason, attrDiags = evalStringAttribute(content.Attributes["reason"])
+	diags = append(diags, attrDiags...)
+	freeze.Location, attrDiags = evalTimeZoneAttribute(content.Attributes["time_zone"])
+	diags = append(diags, attrDiags...)
+	freeze.Start, attrDiags = evalFreezeDateAttribute(content.Attributes["start"])
+	diags = append(diags, attrDiags...)
+	freeze.End, attrDiags = evalFreezeDateAttribute(content.Attributes["end"])
+	diags = append(diags, attrDiags...)
+
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if (freeze.Start.Year == 0) != (freeze.End.Year == 0) {
+		return nil, append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Inconsistent freeze dates",
+			Detail:   fmt.Sprintf("Freeze %q must have both dates with the year, or both without the year to recur every year.", freeze.Name),
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+	return freeze, diags
+}
+
+// evalClockAttribute evaluates the attribute like "02:00" as minutes from the midnight
+func evalClockAttribute(attr *hcl.Attribute) (int, hcl.Diagnostics) {
+	v, diags := evalStringAttribute(attr)
+	if diags.HasErrors() {
+		return 0, diags
+	}
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid %s", attr.Name),
+				Detail:   fmt.Sprintf("%q is not a time. It must be like \"02:00\".", v),
+				Subject:  attr.Expr.Range().Ptr(),
+			},
+		}
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// evalFreezeDateAttribute evaluates the attribute like "2026-12-01", or "12-01" which recurs every year
+func evalFreezeDateAttribute(attr *hcl.Attribute) (updater.FreezeDate, hcl.Diagnostics) {
+	v, diags := evalStringAttribute(attr)
+	if diags.HasErrors() {
+		return updater.FreezeDate{}, diags
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return updater.FreezeDate{Year: t.Year(), Month: t.Month(), Day: t.Day()}, nil
+	}
+	// parse with a leap year, so that "02-29" is valid
+	if t, err := time.Parse("2006-01-02", "2000-"+v); err == nil {
+		return updater.FreezeDate{Month: t.Month(), Day: t.Day()}, nil
+	}
+	return updater.FreezeDate{}, hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s", attr.Name),
+			Detail:   fmt.Sprintf("%q is not a date. It must be like \"2006-01-02\", or \"01-02\" to recur every year.", v),
+			Subject:  attr.Expr.Range().Ptr(),
+		},
+	}
+}
+
+// evalTimeZoneAttribute evaluates the attribute as an IANA time zone like "Asia/Tokyo". It returns UTC if the attribute is not set.
+func evalTimeZoneAttribute(attr *hcl.Attribute) (*time.Location, hcl.Diagnostics) {
+	v, diags := evalStringAttribute(attr)
+	if diags.HasErrors() || v == "" {
+		return time.UTC, diags
+	}
+	loc, err := time.LoadLocation(v)
+	if err != nil {
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid time_zone",
+				Detail:   fmt.Sprintf("Unknown time zone %q. It must be a name in the IANA time zone database, like \"Asia/Tokyo\".", v),
+				Subject:  attr.Expr.Range().Ptr(),
+			},
+		}
+	}
+	return loc, nil
+}
+
+// evalVersionAttribute evaluates the attribute as a workspace version. It returns nil if the attribute is not set.
+func evalVersionAttribute(attr *hcl.Attribute) (*updater.WorkspaceVersion, hcl.Diagnostics) {
+	v, diags := evalStringAttribute(attr)
+	if diags.HasErrors() || v == "" {
+		return nil, diags
+	}
+	wv, err := updater.NewWorkspaceVersion(v)
+	if err != nil {
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid %s", attr.Name),
+				Detail:   fmt.Sprintf("%s. It must be a version, \"latest\" or a version constraint.", err),
+				Subject:  attr.Expr.Range().Ptr(),
+			},
+		}
+	}
+	return wv, nil
+}
+
+func evalStringListAttribute(attr *hcl.Attribute) ([]string, hcl.Diagnostics) {
+	if attr == nil {
+		return nil, nil
+	}
+
+	val, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	val, err := convert.Convert(val, cty.List(cty.String))
+	if err != nil || val.IsNull() || !val.IsWhollyKnown() {
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported argument value",
+				Detail:   fmt.Sprintf("The %q argument must be a list of literal strings.", attr.Name),
+				Subject:  attr.Expr.Range().Ptr(),
+			},
+		}
+	}
+
+	var list []string
+	for _, v := range val.AsValueSlice() {
+		if v.IsNull() {
+			continue
+		}
+		list = append(list, strings.TrimSpace(v.AsString()))
+	}
+	return list, nil
+}
+
+// parseCooldown parses the cooldown like "14d" or "12h"
+func parseCooldown(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
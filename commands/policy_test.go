@@ -0,0 +1,336 @@
+package commands
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+func TestDecodePolicy(t *testing.T) {
+	cases := []struct {
+		src          string
+		projects     map[string]string
+		variableSets map[string]string
+		errorMsg     string
+	}{
+		{
+			src: `
+project "infra" {
+  default_version = "0.12.24"
+}
+
+variable_set "tracking" {
+  default_version = "~> 0.12.0"
+}
+
+project "sandbox" {}
+`,
+			projects:     map[string]string{"infra": "0.12.24", "sandbox": ""},
+			variableSets: map[string]string{"tracking": "~> 0.12.0"},
+		},
+		{
+			src: `
+project "infra" {
+  default_version = "0.12.x"
+}`,
+			errorMsg: "Invalid default_version",
+		},
+		{
+			src: `
+project "infra" {
+  default_versions = "0.12.24"
+}`,
+			errorMsg: "Unsupported argument",
+		},
+	}
+
+	for _, v := range cases {
+		parser := hclparse.NewParser()
+		file, diags := parser.ParseHCL([]byte(v.src), ".tfc-updater.hcl")
+		if diags.HasErrors() {
+			t.Fatalf("Failed of error: %s", diags.Error())
+		}
+
+		policy, diags := decodePolicy(file.Body)
+		if v.errorMsg != "" {
+			if !strings.Contains(diags.Error(), v.errorMsg) {
+				t.Errorf("Failed: want error = %s / got = %s", v.errorMsg, diags.Error())
+			}
+			continue
+		}
+		if diags.HasErrors() {
+			t.Fatalf("Failed of error: %s", diags.Error())
+		}
+
+		got := map[string]map[string]string{"project": {}, "variable_set": {}}
+		for _, sp := range append(policy.Projects, policy.VariableSets...) {
+			got[sp.Kind][sp.Name] = ""
+			if sp.DefaultVersion != nil {
+				got[sp.Kind][sp.Name] = sp.DefaultVersion.String()
+			}
+		}
+		if !reflect.DeepEqual(got["project"], v.projects) || !reflect.DeepEqual(got["variable_set"], v.variableSets) {
+			t.Errorf("Failed: want = %v, %v / got = %v", v.projects, v.variableSets, got)
+		}
+	}
+}
+
+func TestDecodePolicyRules(t *testing.T) {
+	cases := []struct {
+		src        string
+		rules      []string
+		exceptions []string
+		errorMsg   string
+	}{
+		{
+			src: `
+rule "sandbox" {
+  workspaces = ["sandbox-*"]
+  version    = "latest"
+}
+
+rule "prod" {
+  tags     = ["prod", "aws"]
+  update   = "patch"
+  cooldown = "14d"
+}
+
+rule "others" {
+  update   = "minor"
+  cooldown = "12h"
+}
+
+exception "legacy" {
+  version = "0.12.24"
+  expires = "2026-12-31"
+  reason  = "waiting for the provider upgrade"
+}
+`,
+			rules: []string{
+				"sandbox [sandbox-*] [] latest  0s",
+				"prod [] [prod aws] <nil> patch 336h0m0s",
+				"others [] [] <nil> minor 12h0m0s",
+			},
+			exceptions: []string{"legacy 0.12.24 2026-12-31 waiting for the provider upgrade"},
+		},
+		{
+			src: `
+rule "prod" {
+  update = "latest"
+}`,
+			errorMsg: "Invalid update",
+		},
+		{
+			src: `
+rule "prod" {
+  tags = ["prod"]
+}`,
+			errorMsg: "Missing version or update",
+		},
+		{
+			src: `
+rule "prod" {
+  version = "latest"
+  update  = "patch"
+}`,
+			errorMsg: "Conflicting version and update",
+		},
+		{
+			src: `
+rule "prod" {
+  version  = "latest"
+  cooldown = "14d"
+}`,
+			errorMsg: "Unsupported cooldown",
+		},
+		{
+			src: `
+rule "prod" {
+  update   = "patch"
+  cooldown = "two weeks"
+}`,
+			errorMsg: "Invalid cooldown",
+		},
+		{
+			src: `
+rule "prod" {
+  workspaces = "prod-*"
+  update     = "patch"
+}`,
+			errorMsg: "must be a list of literal strings",
+		},
+		{
+			src: `
+exception "legacy" {
+  version = "0.12.24"
+  expires = "12/31/2026"
+}`,
+			errorMsg: "Invalid expires",
+		},
+		{
+			src: `
+exception "legacy" {
+  version = "0.12.24"
+}`,
+			errorMsg: "Missing required argument",
+		},
+	}
+
+	for _, v := range cases {
+		parser := hclparse.NewParser()
+		file, diags := parser.ParseHCL([]byte(v.src), ".tfc-updater.hcl")
+		if diags.HasErrors() {
+			t.Fatalf("Failed of error: %s", diags.Error())
+		}
+
+		policy, diags := decodePolicy(file.Body)
+		if v.errorMsg != "" {
+			if !strings.Contains(diags.Error(), v.errorMsg) {
+				t.Errorf("Failed: want error = %s / got = %s", v.errorMsg, diags.Error())
+			}
+			continue
+		}
+		if diags.HasErrors() {
+			t.Fatalf("Failed of error: %s", diags.Error())
+		}
+
+		var rules, exceptions []string
+		for _, r := range policy.Rules {
+			version := "<nil>"
+			if r.Version != nil {
+				version = r.Version.String()
+			}
+			rules = append(rules, fmt.Sprintf("%s %v %v %s %s %s", r.Name, r.Workspaces, r.Tags, version, r.Update, r.Cooldown))
+		}
+		for _, e := range policy.Exceptions {
+			exceptions = append(exceptions, fmt.Sprintf("%s %s %s %s", e.Workspace, e.Version, e.Expires.Format("2006-01-02"), e.Reason))
+		}
+		if !reflect.DeepEqual(rules, v.rules) || !reflect.DeepEqual(exceptions, v.exceptions) {
+			t.Errorf("Failed: want = %v, %v / got = %v, %v", v.rules, v.exceptions, rules, exceptions)
+		}
+	}
+}
+
+func TestDecodePolicySchedule(t *testing.T) {
+	cases := []struct {
+		src      string
+		windows  []string
+		freezes  []string
+		errorMsg string
+	}{
+		{
+			src: `
+maintenance_window "prod" {
+  tags  = ["prod"]
+  days  = ["mon", "tue", "wed", "thu", "Fri"]
+  start = "02:00"
+  end   = "04:00"
+}
+
+maintenance_window "jp" {
+  workspaces = ["jp-*"]
+  start      = "22:00"
+  end        = "01:00"
+  time_zone  = "Asia/Tokyo"
+}
+
+freeze "december" {
+  tags   = ["prod"]
+  start  = "12-01"
+  end    = "12-31"
+  reason = "code freeze"
+}
+
+freeze "release" {
+  start = "2026-11-02"
+  end   = "2026-11-04"
+}
+`,
+			windows: []string{"prod Mon Tue Wed Thu Fri 02:00-04:00 UTC", "jp every day 22:00-01:00 Asia/Tokyo"},
+			freezes: []string{"december 12-01 - 12-31 UTC code freeze", "release 2026-11-02 - 2026-11-04 UTC "},
+		},
+		{
+			src: `
+maintenance_window "prod" {
+  days  = ["weekday"]
+  start = "02:00"
+  end   = "04:00"
+}`,
+			errorMsg: "Invalid days",
+		},
+		{
+			src: `
+maintenance_window "prod" {
+  start = "2am"
+  end   = "04:00"
+}`,
+			errorMsg: "Invalid start",
+		},
+		{
+			src: `
+maintenance_window "prod" {
+  start = "02:00"
+  end   = "02:00"
+}`,
+			errorMsg: "Empty maintenance window",
+		},
+		{
+			src: `
+maintenance_window "prod" {
+  start     = "02:00"
+  end       = "04:00"
+  time_zone = "Mars/Olympus"
+}`,
+			errorMsg: "Invalid time_zone",
+		},
+		{
+			src: `
+freeze "december" {
+  start = "2026-12-01"
+  end   = "12-31"
+}`,
+			errorMsg: "Inconsistent freeze dates",
+		},
+		{
+			src: `
+freeze "december" {
+  start = "12-32"
+  end   = "12-31"
+}`,
+			errorMsg: "Invalid start",
+		},
+	}
+
+	for _, v := range cases {
+		parser := hclparse.NewParser()
+		file, diags := parser.ParseHCL([]byte(v.src), ".tfc-updater.hcl")
+		if diags.HasErrors() {
+			t.Fatalf("Failed of error: %s", diags.Error())
+		}
+
+		policy, diags := decodePolicy(file.Body)
+		if v.errorMsg != "" {
+			if !strings.Contains(diags.Error(), v.errorMsg) {
+				t.Errorf("Failed: want error = %s / got = %s", v.errorMsg, diags.Error())
+			}
+			continue
+		}
+		if diags.HasErrors() {
+			t.Fatalf("Failed of error: %s", diags.Error())
+		}
+
+		var windows, freezes []string
+		for _, m := range policy.Windows {
+			windows = append(windows, fmt.Sprintf("%s %s", m.Name, m.Describe()))
+		}
+		for _, f := range policy.Freezes {
+			freezes = append(freezes, fmt.Sprintf("%s %s %s", f.Name, f.Describe(), f.Reason))
+		}
+		if !reflect.DeepEqual(windows, v.windows) || !reflect.DeepEqual(freezes, v.freezes) {
+			t.Errorf("Failed: want = %q, %q / got = %q, %q", v.windows, v.freezes, windows, freezes)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+	"github.com/mitchellh/cli"
+	flag "github.com/spf13/pflag"
+)
+
+type ReconcileCommand struct {
+	UI cli.Ui
+}
+
+func (c *ReconcileCommand) Run(args []string) int {
+	var jsonOutput bool
+	opts := &reconcileOptions{global: &globalOptions{}, change: &changeOptions{}}
+
+	f := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	opts.addFlags(f)
+	f.BoolVar(&jsonOutput, "json", false, "Output the result in JSON")
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if opts.project != "" && opts.all {
+		c.UI.Error("--project and --all can't be used together")
+		return 1
+	}
+
+	ctx, cancel := opts.global.context()
+	defer cancel()
+
+	results, err := reconcileWorkspaces(ctx, c.UI, opts, time.Now())
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	if jsonOutput {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+		c.UI.Output(string(out))
+	} else {
+		c.outputResults(results)
+	}
+
+	return reconcileExitCode(results)
+}
+
+// reconcileOptions are the options to reconcile the workspaces, shared with serve
+type reconcileOptions struct {
+	global  *globalOptions
+	change  *changeOptions
+	project string
+	all     bool
+	dryRun  bool
+}
+
+func (o *reconcileOptions) addFlags(f *flag.FlagSet) {
+	o.global.addFlags(f)
+	o.global.addOrganizationFlags(f)
+	o.change.addFlags(f)
+	f.StringVar(&o.project, "project", "", "Reconcile all the workspaces in the project, instead of the workspace of the root path")
+	f.BoolVar(&o.all, "all", false, "Reconcile all the workspaces in the organization, instead of the workspace of the root path")
+	f.BoolVar(&o.dryRun, "dry-run", false, "Show the changes, but don't change the workspaces")
+}
+
+// reconcileWorkspaces reconciles the workspace of the root path, the workspaces in the project, or all of them in the organization.
+// The configuration and the policy file are read every time, so that serve follows their changes.
+func reconcileWorkspaces(ctx context.Context, ui cli.Ui, opts *reconcileOptions, now time.Time) ([]*updater.ReconcileResult, error) {
+	ws, err := InitCLI(ctx, opts.global)
+	if err != nil {
+		return nil, err
+	}
+	if err = opts.change.apply(ws, opts.global); err != nil {
+		return nil, err
+	}
+	ws.SetDryRun(opts.dryRun)
+
+	policy, err := loadPolicy(opts.global.root, opts.global.policyFile)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("Policy file is not found. Create %s in the root path, or specify --policy-file", defaultPolicyFile)
+	}
+
+	for _, e := range policy.ExpiredExceptions(now) {
+		ui.Warn(fmt.Sprintf("%s expired on %s, and is ignored (%s)", e, e.Expires.Format("2006-01-02"), e.Source))
+	}
+
+	workspaces, err := opts.targetWorkspaces(ctx, ws)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*updater.ReconcileResult, len(workspaces))
+	for i, w := range workspaces {
+		results[i] = w.Reconcile(ctx, policy, now)
+	}
+	return results, nil
+}
+
+// targetWorkspaces returns ws, the workspaces in --project, or all of them in the organization with --all
+func (o *reconcileOptions) targetWorkspaces(ctx context.Context, ws *updater.Workspace) ([]*updater.Workspace, error) {
+	if o.project != "" || o.all {
+		return ws.ListWorkspaces(ctx, o.project)
+	}
+	if err := requireRootWorkspace(ws, "--project or --all"); err != nil {
+		return nil, err
+	}
+	return []*updater.Workspace{ws}, nil
+}
+
+func (c *ReconcileCommand) outputResults(results []*updater.ReconcileResult) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKSPACE\tVERSION\tDESIRED\tPOLICY\tSTATUS")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Workspace, r.Version, orDash(r.DesiredVersion), orDash(r.Policy), r.Status)
+	}
+	w.Flush()
+	c.UI.Output(strings.TrimSpace(buf.String()))
+
+	for _, r := range results {
+		if r.Error != "" {
+			c.UI.Error(fmt.Sprintf("%s: %s", r.Workspace, r.Error))
+		}
+	}
+}
+
+// reconcileExitCode returns the highest exit code of the workspaces which failed to be reconciled, in the same way as update
+func reconcileExitCode(results []*updater.ReconcileResult) int {
+	exitCode := 0
+	for _, r := range results {
+		if r.Err() == nil {
+			continue
+		}
+		if code := updateErrorCode(r.Err()); code > exitCode {
+			exitCode = code
+		}
+	}
+	return exitCode
+}
+
+func (c *ReconcileCommand) Help() string {
+	return strings.TrimSpace(helpMessageReconcile)
+}
+
+func (c *ReconcileCommand) Synopsis() string {
+	return "Set the workspaces to the versions declared in the policy file"
+}
+
+const helpMessageReconcile = `
+Usage: terraform-cloud-updater reconcile [OPTION]
+
+Notes:
+  The desired version of each workspace is decided by the policy file in the following order.
+    1. the exception of the workspace which is not expired
+    2. the first rule which the workspace matches
+    3. the default version of the variable set or the project
+  Each workspace is reported as one of the following statuses.
+    in_sync:      the workspace already has the desired version
+    changed:      the workspace is set to the desired version
+    would_change: the workspace would be set to the desired version without --dry-run
+    no_rule:      no policy applies to the workspace
+    error:        the workspace can't be reconciled
+  Exit code is the same as update, if any workspace can't be reconciled.
+
+Options:
+` + helpMessageGlobalOptions + `
+` + helpMessageOrganizationOptions + `
+` + helpMessageChangeOptions + `
+` + helpMessageReconcileOptions + `
+  --json                   Output the result in JSON
+`
+
+const helpMessageReconcileOptions = `  --project                Reconcile all the workspaces in the project, instead of the workspace of the root path
+  --all                    Reconcile all the workspaces in the organization, instead of the workspace of the root path
+  --dry-run                Show the changes, but don't change the workspaces`
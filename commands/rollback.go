@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+	"github.com/mitchellh/cli"
+	flag "github.com/spf13/pflag"
+)
+
+type RollbackCommand struct {
+	UI cli.Ui
+}
+
+func (c *RollbackCommand) Run(args []string) int {
+	var to string
+	var rollbackVer *updater.WorkspaceVersion
+	opts := &globalOptions{}
+	changeOpts := &changeOptions{}
+
+	f := flag.NewFlagSet("rollback", flag.ExitOnError)
+	opts.addFlags(f)
+	changeOpts.addFlags(f)
+	f.StringVar(&to, "to", "", "Version to roll back to")
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	ctx, cancel := opts.context()
+	defer cancel()
+
+	ws, err := InitCLI(ctx, opts)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if err = changeOpts.apply(ws, opts); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	currentVer, err := ws.GetWorkspaceVersion(ctx)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	if to != "" {
+		rollbackVer, err = updater.NewWorkspaceVersion(to)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+	} else {
+		var changedVer *updater.WorkspaceVersion
+		rollbackVer, changedVer, err = ws.GetPreviousVersion()
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+		if rollbackVer == nil {
+			c.UI.Error(fmt.Sprintf("No version change is recorded in %s. Specify the version with --to", changeOpts.journalPath))
+			return 1
+		}
+		if changedVer.String() != currentVer.String() {
+			c.UI.Warn(fmt.Sprintf("Version has been changed from %s to %s after the last update by this tool", changedVer, currentVer))
+		}
+	}
+
+	if currentVer.String() == rollbackVer.String() {
+		c.UI.Warn(fmt.Sprintf("Already version %s", rollbackVer))
+		return 0
+	}
+
+	resolvedVer, err := ws.ResolveWorkspaceVersion(ctx, rollbackVer)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if !ws.IsCompatibleVersion(resolvedVer) {
+		c.UI.Error(fmt.Sprintf("Version %s is not compatible with required version %s", resolvedVer, ws.GetRequiredVersions().String()))
+		outputRequiredVersionSources(c.UI, ws.GetRequiredVersions())
+		c.UI.Info(fmt.Sprintf("\nLink to: %s", ws.GetSettingsLink()))
+		return 3
+	}
+
+	if err = ws.RollbackWorkspaceVersion(ctx, rollbackVer); err != nil {
+		c.UI.Error(err.Error())
+		reportUntouched(ctx, c.UI, ws)
+		return updateErrorCode(err)
+	}
+
+	c.UI.Info(fmt.Sprintf("Rolled back: %s -> %s", currentVer, rollbackVer))
+	c.UI.Info(fmt.Sprintf("\nLink to: %s", ws.GetSettingsLink()))
+	return 0
+}
+
+func (c *RollbackCommand) Help() string {
+	return strings.TrimSpace(helpMessageRollback)
+}
+
+func (c *RollbackCommand) Synopsis() string {
+	return "Roll back Terraform cloud workspace terraform version"
+}
+
+const helpMessageRollback = `
+Usage: terraform-cloud-updater rollback [OPTION]
+
+Notes:
+  The version before the last change made by this tool is restored, based on the journal.
+  Rollback itself is recorded as a rollback, so rolling back again goes back to the version before the previous change.
+
+Options:
+` + helpMessageGlobalOptions + `
+` + helpMessageChangeOptions + `
+  --to                     Version to roll back to, which can be "latest" or a version constraint   (default: the version before the last change)
+`
@@ -0,0 +1,203 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+	"github.com/mitchellh/cli"
+	flag "github.com/spf13/pflag"
+)
+
+type RolloutCommand struct {
+	UI cli.Ui
+}
+
+func (c *RolloutCommand) Run(args []string) int {
+	var waveArgs []string
+	var statePath string
+	var soak time.Duration
+	var queueRun, dryRun, jsonOutput bool
+	opts := &globalOptions{}
+	change := &changeOptions{}
+
+	f := flag.NewFlagSet("rollout", flag.ExitOnError)
+	opts.addFlags(f)
+	change.addFlags(f)
+	f.StringArrayVar(&waveArgs, "wave", nil, "Workspaces in the wave, like tag:dev, name:stg-* or project:prod. Repeat it in the rollout order")
+	f.DurationVar(&soak, "soak", 24*time.Hour, "How long the runs on the new version must have succeeded before the next wave")
+	f.StringVar(&statePath, "state", updater.DefaultRolloutStatePath(), "Path to the rollout state to resume")
+	f.BoolVar(&queueRun, "queue-run", false, "Queue a run after updating each workspace")
+	f.BoolVar(&dryRun, "dry-run", false, "Check everything, but don't change the workspaces")
+	f.BoolVar(&jsonOutput, "json", false, "Output the result in JSON")
+	if len(args) == 0 {
+		c.UI.Error("version is required")
+		c.UI.Output(helpMessageRollout)
+		return 1
+	}
+	if err := f.Parse(args[1:]); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if len(waveArgs) == 0 {
+		c.UI.Error("--wave is required")
+		return 1
+	}
+
+	var waves []*updater.Wave
+	for _, s := range waveArgs {
+		wave, err := updater.NewWave(s)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+		waves = append(waves, wave)
+	}
+
+	ctx, cancel := opts.context()
+	defer cancel()
+
+	ws, err := InitCLI(ctx, opts)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if err = change.apply(ws, opts); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	ws.SetDryRun(dryRun)
+
+	var version *updater.SemanticVersion
+	if args[0] == "latest" {
+		version, err = ws.GetLatestVersion(ctx)
+	} else {
+		version, err = updater.NewSemanticVersion(args[0])
+	}
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	current, err := updater.LoadRolloutState(statePath)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	state := resumeRollout(current, ws.GetOrganization(), version, waves)
+	if state == nil {
+		c.UI.Error(fmt.Sprintf("Another rollout of %s is in %s. Remove it, or specify another --state to start a new rollout", current.Version, statePath))
+		return 1
+	}
+
+	result, err := ws.Rollout(ctx, state, waves, &updater.RolloutOptions{Soak: soak, QueueRun: queueRun}, time.Now())
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if !dryRun {
+		if err = state.Save(statePath); err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to save the rollout state: %s", err))
+			return 1
+		}
+	}
+
+	if jsonOutput {
+		out, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+		c.UI.Output(string(out))
+	} else {
+		c.outputResult(result, dryRun)
+	}
+	return rolloutExitCode(result)
+}
+
+// resumeRollout returns the state to continue the rollout of the version, or a new state if there is none.
+// The complete rollout of another version is replaced, so that "latest" moves on to the new release.
+// nil is returned if the state is another rollout in progress.
+func resumeRollout(state *updater.RolloutState, org string, version *updater.SemanticVersion, waves []*updater.Wave) *updater.RolloutState {
+	if state == nil || (state.Complete && state.Version != version.String()) {
+		return updater.NewRolloutState(org, version, waves)
+	}
+	if !state.IsFor(org, waves) || state.Version != version.String() {
+		return nil
+	}
+	return state
+}
+
+func (c *RolloutCommand) outputResult(result *updater.RolloutResult, dryRun bool) {
+	for i, wave := range result.Waves {
+		c.UI.Output(fmt.Sprintf("Wave %d (%s): %s", i+1, wave.Name, wave.Status))
+		for _, r := range wave.Workspaces {
+			line := fmt.Sprintf("  %s: %s", orDash(r.Workspace), r.Status)
+			if r.Run != "" {
+				line += " " + r.Run
+			}
+			c.UI.Output(line)
+			if r.Error != "" {
+				c.UI.Error(fmt.Sprintf("  %s: %s", orDash(r.Workspace), r.Error))
+			}
+		}
+	}
+
+	switch {
+	case dryRun:
+		c.UI.Info("Dry run: no workspace was changed, and the rollout state was not saved")
+	case result.Complete:
+		c.UI.Info(fmt.Sprintf("Rollout of %s is complete", result.Version))
+	default:
+		c.UI.Info(fmt.Sprintf("Rollout of %s is in progress. Run the same command later to continue", result.Version))
+	}
+}
+
+// rolloutExitCode returns 2 if any workspace failed or can't be checked, or 0 while the rollout is in progress or complete
+func rolloutExitCode(result *updater.RolloutResult) int {
+	for _, wave := range result.Waves {
+		if wave.Status == updater.RolloutFailed || wave.Status == updater.RolloutError {
+			return 2
+		}
+	}
+	return 0
+}
+
+func (c *RolloutCommand) Help() string {
+	return strings.TrimSpace(helpMessageRollout)
+}
+
+func (c *RolloutCommand) Synopsis() string {
+	return "Roll out a Terraform version to the workspaces in waves"
+}
+
+const helpMessageRollout = `
+Usage: terraform-cloud-updater rollout <VERSION> --wave <SELECTOR> [--wave <SELECTOR>...] [OPTION]
+
+Arguments:
+  VERSION                  Terraform version to roll out, or "latest"
+
+Notes:
+  Each wave selects the workspaces by comma separated selectors.
+    tag:<TAG>              workspaces with the tag
+    name:<GLOB>            workspaces whose names match the glob, like name:stg-*
+    project:<PROJECT>      workspaces in the project
+  Each run of the command advances the rollout by one step, and saves the progress in the state file.
+  The next wave is set to the version only after the latest runs of all the workspaces in the previous waves
+  have succeeded on the version for --soak. Runs which planned no changes also count, but plan-only runs don't.
+  Run the same command again, for example on a schedule, to continue. If a wave partly fails,
+  the next run retries only the workspaces which are not set to the version yet.
+  Once the rollout is complete, the rollout of another version, like "latest" after a new release, replaces the state.
+  Exit code is 2 if the latest run of any workspace failed on the version, or the workspace can't be updated.
+
+Options:
+` + helpMessageGlobalOptions + `
+` + helpMessageChangeOptions + `
+  --wave                   Workspaces in the wave. Repeat it in the rollout order
+  --soak                   How long the runs on the new version must have succeeded before the next wave   (default: 24h)
+  --state                  Path to the rollout state to resume   (default: $XDG_DATA_HOME/terraform-cloud-updater/rollout.json)
+  --queue-run              Queue a run after updating each workspace
+  --dry-run                Check everything, but don't change the workspaces
+  --json                   Output the result in JSON
+`
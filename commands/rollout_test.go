@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+)
+
+func TestResumeRollout(t *testing.T) {
+	wave, err := updater.NewWave("tag:dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waves := []*updater.Wave{wave}
+	v1, err := updater.NewSemanticVersion("1.5.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := updater.NewSemanticVersion("1.6.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inProgress := updater.NewRolloutState("chroju", v1, waves)
+	complete := updater.NewRolloutState("chroju", v1, waves)
+	complete.Complete = true
+
+	cases := []struct {
+		state    *updater.RolloutState
+		version  *updater.SemanticVersion
+		expected string
+		resumed  bool
+	}{
+		// no state starts a new rollout
+		{state: nil, version: v1, expected: "1.5.7"},
+		{state: inProgress, version: v1, expected: "1.5.7", resumed: true},
+		// "latest" resolved to a new release doesn't resume the rollout of the old one
+		{state: inProgress, version: v2, expected: ""},
+		{state: complete, version: v1, expected: "1.5.7", resumed: true},
+		// the complete rollout is replaced by the new release
+		{state: complete, version: v2, expected: "1.6.0"},
+	}
+
+	for i, v := range cases {
+		got := resumeRollout(v.state, "chroju", v.version, waves)
+		switch {
+		case v.expected == "":
+			if got != nil {
+				t.Errorf("Failed: case = %d / want = nil / got = %+v", i, got)
+			}
+		case got == nil || got.Version != v.expected || (got == v.state) != v.resumed:
+			t.Errorf("Failed: case = %d / want = %s, resumed %t / got = %+v", i, v.expected, v.resumed, got)
+		}
+	}
+
+	// other waves are another rollout
+	if got := resumeRollout(inProgress, "chroju", v1, append(waves, wave)); got != nil {
+		t.Errorf("Failed: want = nil for other waves / got = %+v", got)
+	}
+}
@@ -0,0 +1,539 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+	"github.com/mitchellh/cli"
+	flag "github.com/spf13/pflag"
+)
+
+// unhealthyCycles is how many intervals serve may go without a successful reconcile before /healthz fails
+const unhealthyCycles = 3
+
+// timeouts to read the requests, so that slow clients don't hold the connections
+const (
+	serveReadHeaderTimeout = 10 * time.Second
+	serveReadTimeout       = 30 * time.Second
+)
+
+type ServeCommand struct {
+	UI cli.Ui
+}
+
+type serveOptions struct {
+	reconcileOptions
+	listen          string
+	interval        time.Duration
+	shutdownTimeout time.Duration
+	rolloutState    string
+	soak            time.Duration
+	githubSecret    string
+	webhookSecret   string
+	tfcToken        string
+	exportOnly      bool
+}
+
+func (c *ServeCommand) Run(args []string) int {
+	opts := &serveOptions{reconcileOptions: reconcileOptions{global: &globalOptions{}, change: &changeOptions{}}}
+
+	f := flag.NewFlagSet("serve", flag.ExitOnError)
+	opts.reconcileOptions.addFlags(f)
+	f.StringVar(&opts.listen, "listen", ":8080", "Address to serve /healthz and /metrics")
+	f.DurationVar(&opts.interval, "interval", 15*time.Minute, "Interval between the end of a reconcile and the start of the next one")
+	f.DurationVar(&opts.shutdownTimeout, "shutdown-timeout", time.Minute, "Timeout to wait for the running reconcile on shutdown")
+	f.StringVar(&opts.rolloutState, "rollout-state", "", "Path to the state of the rollout started by the rollout command, to continue it")
+	f.DurationVar(&opts.soak, "soak", 24*time.Hour, "How long the runs on the new version must have succeeded before the next wave of the rollout")
+	f.StringVar(&opts.githubSecret, "github-webhook-secret", os.Getenv("TFC_UPDATER_GITHUB_WEBHOOK_SECRET"), "Secret of the GitHub webhook to receive the Terraform releases")
+	f.StringVar(&opts.webhookSecret, "webhook-secret", os.Getenv("TFC_UPDATER_WEBHOOK_SECRET"), "Secret to receive the new version requests")
+	f.StringVar(&opts.tfcToken, "notification-token", os.Getenv("TFC_UPDATER_NOTIFICATION_TOKEN"), "Token of the Terraform Cloud notification configuration to receive the runs")
+	f.BoolVar(&opts.exportOnly, "export-only", false, "Only export the metrics of the versions, without reconciling the workspaces")
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if opts.project != "" && opts.all {
+		c.UI.Error("--project and --all can't be used together")
+		return 1
+	}
+	if opts.interval <= 0 {
+		c.UI.Error("--interval must be positive")
+		return 1
+	}
+
+	// stop is canceled by SIGINT or SIGTERM, and the running reconcile gets --shutdown-timeout to finish after that.
+	// --timeout is applied to each cycle instead of the whole process.
+	stop, cancel := (&globalOptions{}).context()
+	defer cancel()
+	work, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	go func() {
+		<-stop.Done()
+		timer := time.NewTimer(opts.shutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancelWork()
+		case <-work.Done():
+		}
+	}()
+
+	s := newServer(c.UI, opts)
+	httpServer := &http.Server{
+		Addr:              opts.listen,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		ReadTimeout:       serveReadTimeout,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- httpServer.ListenAndServe()
+	}()
+	c.UI.Info(fmt.Sprintf("Listening on %s, and reconciling every %s", opts.listen, opts.interval))
+
+	exitCode := 0
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+loop:
+	for {
+		select {
+		case <-stop.Done():
+			break loop
+		case err := <-serverErr:
+			c.UI.Error(fmt.Sprintf("Failed to serve: %s", err))
+			exitCode = 1
+			break loop
+		case <-timer.C:
+			s.cycle(work)
+			timer.Reset(opts.interval)
+		case <-s.triggers:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			s.cycle(work)
+			timer.Reset(opts.interval)
+		}
+	}
+
+	c.UI.Info("Shutting down")
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), opts.shutdownTimeout)
+	defer cancelShutdown()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to shut down: %s", err))
+		exitCode = 1
+	}
+	return exitCode
+}
+
+// server is the state of serve, which is shared by the reconcile loop and the HTTP handlers
+type server struct {
+	ui      cli.Ui
+	opts    *serveOptions
+	started time.Time
+
+	// triggers starts a cycle before the interval, on webhooks
+	triggers chan struct{}
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	// revalidate revalidates the cached releases in the next cycle
+	revalidate bool
+	// announced are the releases received by the new version webhook
+	announced []*updater.TfRelease
+
+	metrics          *metricsRegistry
+	cycles           *metricFamily
+	lastCycle        *metricFamily
+	lastSuccessCycle *metricFamily
+	cycleDuration    *metricFamily
+	workspaces       *metricFamily
+	changes          *metricFamily
+	errors           *metricFamily
+	updates          *metricFamily
+	rolloutWaves     *metricFamily
+	rolloutComplete  *metricFamily
+	versionInfo      *metricFamily
+	versionsBehind   *metricFamily
+	compatible       *metricFamily
+}
+
+func newServer(ui cli.Ui, opts *serveOptions) *server {
+	r := newMetricsRegistry()
+	s := &server{
+		ui:               ui,
+		opts:             opts,
+		started:          time.Now(),
+		triggers:         make(chan struct{}, 1),
+		metrics:          r,
+		cycles:           r.counter("tfc_updater_reconcile_cycles_total", "Number of reconcile cycles by the result."),
+		lastCycle:        r.gauge("tfc_updater_last_reconcile_timestamp_seconds", "Unix time when the last reconcile cycle started."),
+		lastSuccessCycle: r.gauge("tfc_updater_last_successful_reconcile_timestamp_seconds", "Unix time when the last successful reconcile cycle started."),
+		cycleDuration:    r.gauge("tfc_updater_last_reconcile_duration_seconds", "Duration of the last reconcile cycle."),
+		workspaces:       r.gauge("tfc_updater_workspaces", "Number of workspaces by the status in the last successful reconcile cycle."),
+		changes:          r.counter("tfc_updater_workspace_changes_total", "Number of version changes of the workspace."),
+		errors:           r.counter("tfc_updater_workspace_errors_total", "Number of errors on reconciling the workspace."),
+		updates:          r.counter("tfc_updater_updates_total", "Number of version updates of the workspaces by the result."),
+		rolloutWaves:     r.gauge("tfc_updater_rollout_waves", "Number of waves of the rollout by the status."),
+		rolloutComplete:  r.gauge("tfc_updater_rollout_complete", "1 if all the waves of the rollout are healthy, or 0."),
+		versionInfo:      r.gauge("tfc_workspace_terraform_version_info", "Terraform version which the workspace currently resolves to."),
+		versionsBehind:   r.gauge("tfc_workspace_versions_behind", "Number of stable releases newer than the version of the workspace by the level."),
+		compatible:       r.gauge("tfc_workspace_version_compatible", "1 if the version of the workspace is compatible with the required versions, or 0."),
+	}
+	for _, result := range []string{"success", "failure"} {
+		s.cycles.add(0, "result", result)
+		s.updates.add(0, "result", result)
+	}
+	return s
+}
+
+// trigger starts a cycle as soon as the running one finishes.
+// The triggers during a cycle are merged into one.
+func (s *server) trigger(reason string, revalidate bool) {
+	s.mu.Lock()
+	s.revalidate = s.revalidate || revalidate
+	s.mu.Unlock()
+
+	s.ui.Info(fmt.Sprintf("Triggered by %s", reason))
+	select {
+	case s.triggers <- struct{}{}:
+	default:
+	}
+}
+
+// cycle reconciles the workspaces, continues the rollout if --rollout-state is set, and measures the drift of the versions.
+// With --export-only, only the drift is measured.
+func (s *server) cycle(ctx context.Context) {
+	ctx, cancel := s.cycleContext(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	revalidate := s.revalidate
+	s.revalidate = false
+	s.mu.Unlock()
+
+	opts := s.opts.reconcileOptions
+	global := *opts.global
+	global.revalidate = revalidate
+	global.announced = s.pruneAnnounced(ctx, &global)
+	opts.global = &global
+
+	if s.opts.exportOnly {
+		start := time.Now()
+		err := s.drift(ctx, &opts)
+		s.recordCycle(start, err)
+		if err != nil {
+			s.ui.Error(fmt.Sprintf("Failed to measure the versions: %s", err))
+		}
+		return
+	}
+
+	s.reconcile(ctx, &opts)
+	if s.opts.rolloutState != "" {
+		s.rollout(ctx, &opts)
+	}
+	if err := s.drift(ctx, &opts); err != nil {
+		s.ui.Error(fmt.Sprintf("Failed to measure the versions: %s", err))
+	}
+}
+
+// announce keeps the release received by the webhook, so that the following cycles use it even before GitHub lists it
+func (s *server) announce(v *updater.SemanticVersion, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.announced {
+		if r.SemanticVersion.Compare(v) == 0 {
+			return
+		}
+	}
+	release := &updater.TfRelease{Tag: "v" + v.String(), PublishedAt: now, SemanticVersion: v}
+	s.announced = append([]*updater.TfRelease{release}, s.announced...)
+}
+
+// pruneAnnounced drops the announced releases which the source of the releases lists now, and returns the rest.
+// They are kept if the source fails, and pruned in the next cycle.
+func (s *server) pruneAnnounced(ctx context.Context, global *globalOptions) []*updater.TfRelease {
+	s.mu.Lock()
+	announced := s.announced
+	s.mu.Unlock()
+	if len(announced) == 0 {
+		return nil
+	}
+
+	listed, err := newTfReleasesSource(global, updater.NewHTTPClient(global.maxRetries+1)).List(ctx)
+	if err != nil {
+		return announced
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rest []*updater.TfRelease
+	for _, a := range s.announced {
+		found := false
+		for _, r := range listed {
+			if found = r.SemanticVersion.Compare(a.SemanticVersion) == 0; found {
+				break
+			}
+		}
+		if !found {
+			rest = append(rest, a)
+		}
+	}
+	s.announced = rest
+	return rest
+}
+
+// cycleContext returns the context of a cycle, which is canceled by --timeout
+func (s *server) cycleContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.opts.global.timeout > 0 {
+		return context.WithTimeout(ctx, s.opts.global.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// recordCycle records the result of the cycle started at start in the metrics and /healthz
+func (s *server) recordCycle(start time.Time, err error) {
+	s.lastCycle.set(float64(start.Unix()))
+	s.cycleDuration.set(time.Since(start).Seconds())
+	if err != nil {
+		s.cycles.add(1, "result", "failure")
+		return
+	}
+
+	s.cycles.add(1, "result", "success")
+	s.lastSuccessCycle.set(float64(start.Unix()))
+	s.mu.Lock()
+	s.lastSuccess = start
+	s.mu.Unlock()
+}
+
+// reconcile runs a reconcile, and records the result in the metrics
+func (s *server) reconcile(ctx context.Context, opts *reconcileOptions) {
+	start := time.Now()
+	results, err := reconcileWorkspaces(ctx, s.ui, opts, start)
+	s.recordCycle(start, err)
+	if err != nil {
+		s.ui.Error(fmt.Sprintf("Failed to reconcile: %s", err))
+		return
+	}
+
+	s.workspaces.reset()
+	counts := map[string]int{}
+	for _, r := range results {
+		s.workspaces.add(1, "status", r.Status)
+		counts[r.Status]++
+		switch r.Status {
+		case updater.ReconcileChanged:
+			s.changes.add(1, "organization", r.Organization, "workspace", r.Workspace)
+			s.updates.add(1, "result", "success")
+			s.ui.Info(fmt.Sprintf("%s/%s: %s -> %s (%s)", r.Organization, r.Workspace, r.Version, r.DesiredVersion, r.Policy))
+		case updater.ReconcileError:
+			s.errors.add(1, "organization", r.Organization, "workspace", r.Workspace)
+			// the workspace failed to be updated, if the desired version was decided
+			if r.DesiredVersion != "" {
+				s.updates.add(1, "result", "failure")
+			}
+			s.ui.Error(fmt.Sprintf("%s/%s: %s", r.Organization, r.Workspace, r.Error))
+		}
+	}
+
+	var summary []string
+	for status, n := range counts {
+		summary = append(summary, fmt.Sprintf("%d %s", n, status))
+	}
+	sort.Strings(summary)
+	s.ui.Info(fmt.Sprintf("Reconciled %d workspaces in %s: %s", len(results), time.Since(start).Round(time.Millisecond), strings.Join(summary, ", ")))
+}
+
+// drift measures how far the workspaces are behind the latest stable release, and records it in the metrics.
+// The policy file is not needed.
+func (s *server) drift(ctx context.Context, opts *reconcileOptions) error {
+	ws, err := InitCLI(ctx, opts.global)
+	if err != nil {
+		return err
+	}
+	workspaces, err := opts.targetWorkspaces(ctx, ws)
+	if err != nil {
+		return err
+	}
+
+	results := make([]*updater.DriftResult, len(workspaces))
+	for i, w := range workspaces {
+		results[i] = w.Drift(ctx)
+	}
+	s.recordDrift(results)
+	return nil
+}
+
+// recordDrift replaces the metrics of the versions with the results.
+// The workspaces which failed to be measured are logged, and not exposed.
+func (s *server) recordDrift(results []*updater.DriftResult) {
+	s.versionInfo.reset()
+	s.versionsBehind.reset()
+	s.compatible.reset()
+	for _, r := range results {
+		if r.Error != "" {
+			s.ui.Error(fmt.Sprintf("%s/%s: %s", r.Organization, r.Workspace, r.Error))
+			continue
+		}
+
+		s.versionInfo.set(1, "organization", r.Organization, "workspace", r.Workspace, "version", r.Version)
+		s.versionsBehind.set(float64(r.MajorsBehind), "organization", r.Organization, "workspace", r.Workspace, "level", "major")
+		s.versionsBehind.set(float64(r.MinorsBehind), "organization", r.Organization, "workspace", r.Workspace, "level", "minor")
+		s.versionsBehind.set(float64(r.PatchesBehind), "organization", r.Organization, "workspace", r.Workspace, "level", "patch")
+		compatible := 0.0
+		if r.Compatible {
+			compatible = 1
+		}
+		s.compatible.set(compatible, "organization", r.Organization, "workspace", r.Workspace)
+	}
+}
+
+// rollout advances the rollout in the state file by one step, which is started by the rollout command.
+// Nothing is done if the state file doesn't exist.
+func (s *server) rollout(ctx context.Context, opts *reconcileOptions) {
+	state, err := updater.LoadRolloutState(s.opts.rolloutState)
+	if err != nil || state == nil {
+		if err != nil {
+			s.ui.Error(fmt.Sprintf("Failed to continue the rollout: %s", err))
+		}
+		return
+	}
+
+	// the wave names are the selectors given to the rollout command
+	var waves []*updater.Wave
+	for _, ws := range state.Waves {
+		wave, err := updater.NewWave(ws.Name)
+		if err != nil {
+			s.ui.Error(fmt.Sprintf("Failed to continue the rollout: %s", err))
+			return
+		}
+		waves = append(waves, wave)
+	}
+
+	ws, err := InitCLI(ctx, opts.global)
+	if err == nil {
+		err = opts.change.apply(ws, opts.global)
+	}
+	if err != nil {
+		s.ui.Error(fmt.Sprintf("Failed to continue the rollout: %s", err))
+		return
+	}
+	ws.SetDryRun(opts.dryRun)
+
+	result, err := ws.Rollout(ctx, state, waves, &updater.RolloutOptions{Soak: s.opts.soak}, time.Now())
+	if err == nil && !opts.dryRun {
+		err = state.Save(s.opts.rolloutState)
+	}
+	if err != nil {
+		s.ui.Error(fmt.Sprintf("Failed to continue the rollout: %s", err))
+		return
+	}
+
+	s.rolloutWaves.reset()
+	var summary []string
+	for _, wave := range result.Waves {
+		s.rolloutWaves.add(1, "status", wave.Status)
+		summary = append(summary, fmt.Sprintf("%s %s", wave.Name, wave.Status))
+		for _, r := range wave.Workspaces {
+			if r.Error != "" {
+				s.ui.Error(fmt.Sprintf("Rollout of %s: %s: %s", result.Version, orDash(r.Workspace), r.Error))
+			}
+		}
+	}
+	complete := 0.0
+	if result.Complete {
+		complete = 1
+	}
+	s.rolloutComplete.set(complete)
+	s.ui.Info(fmt.Sprintf("Rollout of %s: %s", result.Version, strings.Join(summary, ", ")))
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/metrics", s.serveMetrics)
+	mux.HandleFunc("/webhooks/github", s.githubWebhook)
+	mux.HandleFunc("/webhooks/release", s.releaseWebhook)
+	mux.HandleFunc("/webhooks/tfc", s.tfcWebhook)
+	return mux
+}
+
+// healthz fails if no reconcile has succeeded for a few intervals, so that a stuck process is restarted
+func (s *server) healthz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	since := s.lastSuccess
+	s.mu.Unlock()
+	if since.IsZero() {
+		since = s.started
+	}
+
+	if time.Since(since) > unhealthyCycles*s.opts.interval {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "no successful reconcile since %s\n", since.Format(time.RFC3339))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := s.metrics.writeTo(w); err != nil {
+		s.ui.Error(fmt.Sprintf("Failed to write metrics: %s", err))
+	}
+}
+
+func (c *ServeCommand) Help() string {
+	return strings.TrimSpace(helpMessageServe)
+}
+
+func (c *ServeCommand) Synopsis() string {
+	return "Reconcile the workspaces with the policy file on an interval"
+}
+
+const helpMessageServe = `
+Usage: terraform-cloud-updater serve [OPTION]
+
+Notes:
+  serve runs reconcile on an interval as a long-running process, reading the configuration,
+  the policy file and the Terraform releases every time. It serves the following endpoints.
+    /healthz:  fails if no reconcile has succeeded for 3 intervals
+    /metrics:  metrics in the Prometheus text format
+    /webhooks/github:   GitHub release events of hashicorp/terraform, with --github-webhook-secret
+    /webhooks/release:  requests like {"version": "1.5.7"} signed in X-Signature-256, with --webhook-secret
+    /webhooks/tfc:      Terraform Cloud run notifications, with --notification-token
+  The webhooks are answered with 202 and start a reconcile without waiting for the interval.
+  The release webhooks also revalidate the cached Terraform releases, and the version of /webhooks/release
+  is added to the releases until GitHub lists it, so that it is used at once. Pre-releases are ignored.
+  With --rollout-state, the rollout started by the rollout command is continued after every reconcile,
+  so that the run notifications move it on to the next wave.
+  After every reconcile, it measures how far the workspaces are behind the latest stable release
+  and exposes the following metrics. With --export-only, it only measures them without the policy file.
+    tfc_workspace_terraform_version_info{organization,workspace,version}
+    tfc_workspace_versions_behind{organization,workspace,level="major|minor|patch"}
+    tfc_workspace_version_compatible{organization,workspace}
+    tfc_updater_updates_total{result="success|failure"}
+  --timeout is applied to each cycle, instead of the whole process.
+  On SIGINT or SIGTERM, it waits for the running reconcile until --shutdown-timeout, and exits.
+
+Options:
+` + helpMessageGlobalOptions + `
+` + helpMessageOrganizationOptions + `
+` + helpMessageChangeOptions + `
+` + helpMessageReconcileOptions + `
+  --listen                 Address to serve /healthz and /metrics   (default: :8080)
+  --interval               Interval between the end of a reconcile and the start of the next one   (default: 15m)
+  --shutdown-timeout       Timeout to wait for the running reconcile on shutdown   (default: 1m)
+  --rollout-state          Path to the state of the rollout started by the rollout command, to continue it
+  --soak                   How long the runs on the new version must have succeeded before the next wave   (default: 24h)
+  --github-webhook-secret  Secret of the GitHub webhook   (default: $TFC_UPDATER_GITHUB_WEBHOOK_SECRET)
+  --webhook-secret         Secret of the new version webhook   (default: $TFC_UPDATER_WEBHOOK_SECRET)
+  --notification-token     Token of the Terraform Cloud notification configuration   (default: $TFC_UPDATER_NOTIFICATION_TOKEN)
+  --export-only            Only export the metrics of the versions, without reconciling the workspaces
+`
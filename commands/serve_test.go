@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestServeHandler(t *testing.T) {
+	cases := []struct {
+		path        string
+		lastSuccess time.Duration
+		status      int
+		body        string
+	}{
+		{path: "/healthz", status: http.StatusOK, body: "ok"},
+		{path: "/healthz", lastSuccess: 10 * time.Minute, status: http.StatusOK, body: "ok"},
+		{path: "/healthz", lastSuccess: time.Hour, status: http.StatusServiceUnavailable, body: "no successful reconcile since"},
+		{path: "/metrics", status: http.StatusOK, body: `tfc_updater_reconcile_cycles_total{result="failure"} 0`},
+		{path: "/unknown", status: http.StatusNotFound},
+	}
+
+	for _, v := range cases {
+		s := newServer(cli.NewMockUi(), &serveOptions{interval: 15 * time.Minute})
+		if v.lastSuccess > 0 {
+			s.lastSuccess = time.Now().Add(-v.lastSuccess)
+		}
+		ts := httptest.NewServer(s.handler())
+
+		resp, err := http.Get(ts.URL + v.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		ts.Close()
+
+		if resp.StatusCode != v.status || !strings.Contains(string(body), v.body) {
+			t.Errorf("Failed: path = %s / want = %d %s / got = %d %s", v.path, v.status, v.body, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestServeCycleContext(t *testing.T) {
+	cases := []struct {
+		timeout  time.Duration
+		deadline bool
+	}{
+		{timeout: 0, deadline: false},
+		{timeout: time.Minute, deadline: true},
+	}
+
+	for _, v := range cases {
+		opts := &serveOptions{reconcileOptions: reconcileOptions{global: &globalOptions{timeout: v.timeout}}}
+		s := newServer(cli.NewMockUi(), opts)
+
+		// each cycle gets its own deadline, so that the timeout doesn't stop the process
+		for i := 0; i < 2; i++ {
+			start := time.Now()
+			ctx, cancel := s.cycleContext(context.Background())
+			deadline, ok := ctx.Deadline()
+			cancel()
+			if ok != v.deadline || (ok && deadline.Before(start.Add(v.timeout))) {
+				t.Errorf("Failed: timeout = %s / want deadline = %t / got = %v, %t", v.timeout, v.deadline, deadline, ok)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+	"github.com/mitchellh/cli"
+	flag "github.com/spf13/pflag"
+)
+
+type SyncCommand struct {
+	UI cli.Ui
+}
+
+func (c *SyncCommand) Run(args []string) int {
+	var pinFilePath string
+	var reverse bool
+	opts := &globalOptions{}
+	changeOpts := &changeOptions{}
+
+	f := flag.NewFlagSet("sync", flag.ExitOnError)
+	opts.addFlags(f)
+	changeOpts.addFlags(f)
+	f.StringVar(&pinFilePath, "pin-file", "", "Path to .terraform-version or .tool-versions")
+	f.BoolVar(&reverse, "reverse", false, "Write the workspace version back into the pin file")
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	ctx, cancel := opts.context()
+	defer cancel()
+
+	ws, err := InitCLI(ctx, opts)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if err = changeOpts.apply(ws, opts); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	pinFile, err := findPinFile(opts.root, pinFilePath, reverse)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	currentWsVer, err := ws.GetWorkspaceVersion(ctx)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	currentVer, err := ws.ResolveWorkspaceVersion(ctx, currentWsVer)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	if reverse {
+		if err = pinFile.Write(currentVer); err != nil {
+			c.UI.Error(err.Error())
+			return 2
+		}
+		c.UI.Info(fmt.Sprintf("Wrote: %s to %s", currentVer, pinFile.Path))
+		return 0
+	}
+
+	spec, err := pinFile.Read()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	pinnedVer, err := ws.ResolveVersionSpec(ctx, spec)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	if currentWsVer.String() == pinnedVer.String() {
+		c.UI.Warn(fmt.Sprintf("Already synced with %s %s", filepath.Base(pinFile.Path), pinnedVer))
+		return 0
+	}
+
+	if !ws.IsCompatibleVersion(pinnedVer) {
+		c.UI.Error(fmt.Sprintf("Version %s pinned in %s is not compatible with required version %s", pinnedVer, pinFile.Path, ws.GetRequiredVersions().String()))
+		outputRequiredVersionSources(c.UI, ws.GetRequiredVersions())
+		c.UI.Info(fmt.Sprintf("\nLink to: %s", ws.GetSettingsLink()))
+		return 3
+	}
+
+	if err = ws.UpdateVersion(ctx, pinnedVer); err != nil {
+		c.UI.Error(err.Error())
+		reportUntouched(ctx, c.UI, ws)
+		return updateErrorCode(err)
+	}
+
+	c.UI.Info(fmt.Sprintf("Updated: %s -> %s", describeVersion(currentWsVer, currentVer), pinnedVer))
+	c.UI.Info(fmt.Sprintf("\nLink to: %s", ws.GetSettingsLink()))
+	return 0
+}
+
+// findPinFile returns the pin file given by the option, or searches it from the root path.
+// In reverse mode, .terraform-version is created in the root path if no pin file is found.
+func findPinFile(root, path string, reverse bool) (*updater.PinFile, error) {
+	if path != "" {
+		return updater.NewPinFile(path)
+	}
+
+	pinFile, err := updater.FindPinFile(root)
+	if err != nil && reverse {
+		return updater.NewPinFile(filepath.Join(root, ".terraform-version"))
+	}
+	return pinFile, err
+}
+
+func (c *SyncCommand) Help() string {
+	return strings.TrimSpace(helpMessageSync)
+}
+
+func (c *SyncCommand) Synopsis() string {
+	return "Sync Terraform cloud workspace terraform version with .terraform-version or .tool-versions"
+}
+
+const helpMessageSync = `
+Usage: terraform-cloud-updater sync [OPTION]
+
+Notes:
+  The pinned version is searched from .terraform-version (tfenv) or .tool-versions (asdf),
+  from the root path up to the root directory.
+  tfenv's "latest", "latest:<regex>" and "min-required" are also available.
+
+Options:
+` + helpMessageGlobalOptions + `
+` + helpMessageChangeOptions + `
+  --pin-file               Path to .terraform-version or .tool-versions   (default: search from the root path)
+  --reverse                Write the workspace version back into the pin file
+`
@@ -1,9 +1,11 @@
 package commands
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/chroju/terraform-cloud-updater/updater"
 	"github.com/mitchellh/cli"
@@ -14,72 +16,331 @@ type UpdateCommand struct {
 	UI cli.Ui
 }
 
+type updateOptions struct {
+	globalOptions
+	changeOptions
+	notifyOptions
+	version         string
+	project         string
+	queueRunMessage string
+	runTimeout      time.Duration
+	track           bool
+	verify          bool
+	queueRun        bool
+	waitRun         bool
+	dryRun          bool
+	jsonOutput      bool
+}
+
+// updateResult is the result of update, which is output with --json
+type updateResult struct {
+	Organization   string `json:"organization"`
+	Workspace      string `json:"workspace"`
+	CurrentVersion string `json:"current_version"`
+	NewVersion     string `json:"new_version"`
+	Changed        bool   `json:"changed"`
+	WouldChange    bool   `json:"would_change"`
+	DryRun         bool   `json:"dry_run"`
+	Run            string `json:"run,omitempty"`
+	Link           string `json:"link"`
+	Error          string `json:"error,omitempty"`
+	ExitCode       int    `json:"exit_code"`
+}
+
+// quietUi discards the informational outputs, so that stdout only has the JSON output
+type quietUi struct {
+	cli.Ui
+}
+
+func (u *quietUi) Info(string)   {}
+func (u *quietUi) Output(string) {}
+
 func (c *UpdateCommand) Run(args []string) int {
-	var root, token string
-	var updateVer *updater.SemanticVersion
+	opts := &updateOptions{}
 
-	currentDir, _ := os.Getwd()
-	f := flag.NewFlagSet("check", flag.ExitOnError)
-	f.StringVar(&token, "token", "", "Terraform Cloud token")
-	f.StringVar(&root, "root-path", currentDir, "Terraform config root path (default: current directory)")
+	f := flag.NewFlagSet("update", flag.ExitOnError)
+	opts.globalOptions.addFlags(f)
+	opts.globalOptions.addOrganizationFlags(f)
+	opts.changeOptions.addFlags(f)
+	opts.notifyOptions.addFlags(f)
+	f.StringVar(&opts.project, "project", "", "Update all the workspaces in the project, instead of the workspace of the root path")
+	f.BoolVar(&opts.track, "track", false, "Set \"latest\" or a version constraint to the workspace, instead of pinning a version")
+	f.BoolVar(&opts.verify, "verify", false, "Verify the new version with a plan-only run on it, and update only if the plan succeeds")
+	f.BoolVar(&opts.queueRun, "queue-run", false, "Queue a run after updating the version")
+	f.StringVar(&opts.queueRunMessage, "queue-run-message", "", "Message of the queued run")
+	f.BoolVar(&opts.waitRun, "wait-run", false, "Wait until the queued run finishes or needs a confirmation")
+	f.DurationVar(&opts.runTimeout, "run-timeout", 30*time.Minute, "Timeout to wait for runs")
+	f.BoolVar(&opts.dryRun, "dry-run", false, "Check everything, but don't change the workspace")
+	f.BoolVar(&opts.jsonOutput, "json", false, "Output the result in JSON")
+	if len(args) == 0 {
+		c.UI.Error("version is required")
+		c.UI.Output(helpMessageUpdate)
+		return 1
+	}
 	if err := f.Parse(args[1:]); err != nil {
 		c.UI.Error(err.Error())
 		return 1
 	}
+	opts.version = args[0]
 
-	ws, err := InitCLI(root, token)
+	notifications, err := opts.notifications(&opts.globalOptions)
 	if err != nil {
 		c.UI.Error(err.Error())
 		return 1
 	}
 
-	if args[0] == "latest" {
-		updateVer, err = ws.GetLatestVersion()
+	ctx, cancel := opts.context()
+	defer cancel()
+
+	ui := c.UI
+	if opts.jsonOutput {
+		c.UI = &quietUi{Ui: ui}
+	}
+
+	results := c.update(ctx, opts)
+	sendNotifications(ctx, c.UI, notifications, updateNotificationEvents(results))
+	exitCode := 0
+	for _, result := range results {
+		if result.ExitCode > exitCode {
+			exitCode = result.ExitCode
+		}
+	}
+	if !opts.jsonOutput {
+		return exitCode
+	}
+
+	out, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+	ui.Output(string(out))
+	return exitCode
+}
+
+// update updates the workspace of the root path, or all the workspaces in the project
+func (c *UpdateCommand) update(ctx context.Context, opts *updateOptions) []*updateResult {
+	fail := func(err error) []*updateResult {
+		c.UI.Error(err.Error())
+		return []*updateResult{{DryRun: opts.dryRun, Error: err.Error(), ExitCode: 1}}
+	}
+
+	ws, err := InitCLI(ctx, &opts.globalOptions)
+	if err != nil {
+		return fail(err)
+	}
+	if err = opts.changeOptions.apply(ws, &opts.globalOptions); err != nil {
+		return fail(err)
+	}
+	ws.SetDryRun(opts.dryRun)
+
+	workspaces := []*updater.Workspace{ws}
+	if opts.project != "" {
+		if workspaces, err = ws.ListWorkspaces(ctx, opts.project); err != nil {
+			return fail(err)
+		}
+	} else if err = requireRootWorkspace(ws, "--project"); err != nil {
+		return fail(err)
+	}
+
+	results := make([]*updateResult, len(workspaces))
+	for i, w := range workspaces {
+		if opts.project != "" {
+			c.UI.Info(fmt.Sprintf("\n== %s/%s", w.GetOrganization(), w.GetName()))
+		}
+		results[i] = &updateResult{
+			Organization: w.GetOrganization(),
+			Workspace:    w.GetName(),
+			Link:         w.GetSettingsLink(),
+			DryRun:       opts.dryRun,
+		}
+		results[i].ExitCode = c.updateWorkspace(ctx, opts, w, results[i])
+	}
+	return results
+}
+
+// updateWorkspace updates the workspace, and fills the result on the way
+func (c *UpdateCommand) updateWorkspace(ctx context.Context, opts *updateOptions, ws *updater.Workspace, result *updateResult) int {
+	var updateVer *updater.SemanticVersion
+	var newVer *updater.WorkspaceVersion
+	var err error
+	fail := func(err error, code int) int {
+		c.UI.Error(err.Error())
+		result.Error = err.Error()
+		if !result.Changed {
+			reportUntouched(ctx, c.UI, ws)
+		}
+		return code
+	}
+
+	switch {
+	case opts.track:
+		newVer, err = updater.NewWorkspaceVersion(opts.version)
+		if err != nil {
+			c.UI.Output(helpMessageUpdate)
+			return fail(err, 1)
+		}
+		if newVer.IsPinned() {
+			return fail(fmt.Errorf("--track needs \"latest\" or a version constraint like \"~> 0.12.0\", but got %s", opts.version), 1)
+		}
+		if updateVer, err = ws.ResolveWorkspaceVersion(ctx, newVer); err != nil {
+			return fail(err, 1)
+		}
+	case opts.version == "latest":
+		updateVer, err = ws.GetLatestVersion(ctx)
 		if err != nil {
-			c.UI.Error(err.Error())
-			return 1
+			return fail(err, 1)
 		}
-	} else {
-		updateVer, err = updater.NewSemanticVersion(args[0])
+		newVer = updater.PinnedWorkspaceVersion(updateVer)
+	default:
+		updateVer, err = updater.NewSemanticVersion(opts.version)
 		if err != nil {
-			c.UI.Error(fmt.Sprintf("%s is not valid version", args[0]))
 			c.UI.Output(helpMessageUpdate)
-			return 1
+			return fail(fmt.Errorf("%s is not valid version", opts.version), 1)
 		}
+		newVer = updater.PinnedWorkspaceVersion(updateVer)
 	}
+	result.NewVersion = newVer.String()
 
-	currentVer, err := ws.GetCurrentVersion()
+	currentWsVer, err := ws.GetWorkspaceVersion(ctx)
+	if isUnknownVersion(err) {
+		result.CurrentVersion = "unknown"
+		return fail(fmt.Errorf("Current version is unknown: %s", err), 1)
+	} else if err != nil {
+		return fail(err, 1)
+	}
+	currentVer, err := ws.ResolveWorkspaceVersion(ctx, currentWsVer)
 	if err != nil {
-		c.UI.Error(err.Error())
-		return 1
+		return fail(err, 1)
 	}
+	result.CurrentVersion = currentWsVer.String()
 
-	if currentVer.String() == updateVer.String() {
-		c.UI.Warn(fmt.Sprintf("Already latest version %s", updateVer.String()))
+	if currentWsVer.String() == newVer.String() {
+		if opts.track {
+			c.UI.Warn(fmt.Sprintf("Already %s", describeVersion(currentWsVer, currentVer)))
+		} else {
+			c.UI.Warn(fmt.Sprintf("Already latest version %s", updateVer.String()))
+		}
 		return 0
 	}
 
 	if !ws.IsCompatibleVersion(updateVer) {
 		c.UI.Error("This version is not compatible with required version.")
-		if args[0] == "latest" {
+		if opts.version == "latest" {
 			c.UI.Info(fmt.Sprintf("New version %s is available, but it is not compatible with required version %s", updateVer.String(), ws.GetRequiredVersions().String()))
 		} else {
 			c.UI.Error(fmt.Sprintf("Version %s is not compatible with required version %s", updateVer.String(), ws.GetRequiredVersions().String()))
 		}
+		outputRequiredVersionSources(c.UI, ws.GetRequiredVersions())
 		c.UI.Info(fmt.Sprintf("\nLink to: %s", ws.GetSettingsLink()))
+		result.Error = fmt.Sprintf("Version %s is not compatible with required version %s", updateVer.String(), ws.GetRequiredVersions().String())
 		return 3
 	}
 
-	if err = ws.UpdateVersion(updateVer); err != nil {
-		c.UI.Error(err.Error())
-		return 2
+	if opts.verify {
+		run, err := ws.VerifyAndUpdateVersion(ctx, newVer, opts.runTimeout)
+		if run != nil {
+			c.UI.Info(fmt.Sprintf("Plan: %s (%s)", ws.GetRunLink(run), run.Status))
+			result.Run = ws.GetRunLink(run)
+		}
+		if err != nil {
+			return fail(err, updateErrorCode(err))
+		}
+	} else if err = ws.SetWorkspaceVersion(ctx, newVer); err != nil {
+		return fail(err, updateErrorCode(err))
+	}
+
+	if opts.dryRun {
+		result.WouldChange = true
+		c.UI.Info(fmt.Sprintf("Would update: %s -> %s", describeVersion(currentWsVer, currentVer), describeVersion(newVer, updateVer)))
+		c.UI.Info(fmt.Sprintf("\nLink to: %s", ws.GetSettingsLink()))
+		return 0
+	}
+	result.Changed = true
+	c.UI.Info(fmt.Sprintf("Updated: %s -> %s", describeVersion(currentWsVer, currentVer), describeVersion(newVer, updateVer)))
+
+	if opts.queueRun {
+		message := opts.queueRunMessage
+		if message == "" {
+			message = fmt.Sprintf("Terraform version updated to %s by terraform-cloud-updater", updateVer)
+		}
+		if exitCode := c.queueRun(ctx, ws, result, message, opts.waitRun, opts.runTimeout); exitCode != 0 {
+			return exitCode
+		}
 	}
 
-	c.UI.Info(fmt.Sprintf("Updated: %s -> %s", currentVer, updateVer))
 	c.UI.Info(fmt.Sprintf("\nLink to: %s", ws.GetSettingsLink()))
 	return 0
 }
 
+// updateNotificationEvents returns the events of the workspaces which were changed or failed to be changed.
+// Nothing is notified on --dry-run.
+func updateNotificationEvents(results []*updateResult) []*updater.NotificationEvent {
+	var events []*updater.NotificationEvent
+	for _, r := range results {
+		if r.DryRun || r.Workspace == "" || (!r.Changed && r.Error == "") {
+			continue
+		}
+		kind := updater.NotifyFailed
+		if r.Changed {
+			// the version was changed, even if the queued run failed after that
+			kind = updater.NotifyUpdated
+		}
+		events = append(events, &updater.NotificationEvent{
+			Kind:           kind,
+			Organization:   r.Organization,
+			Workspace:      r.Workspace,
+			CurrentVersion: r.CurrentVersion,
+			NewVersion:     r.NewVersion,
+			Link:           r.Link,
+			Detail:         r.Error,
+		})
+	}
+	return events
+}
+
+// updateErrorCode returns the exit code for the error on updating the version
+func updateErrorCode(err error) int {
+	switch err.(type) {
+	case *updater.DowngradeError:
+		return 3
+	case *updater.BusyError:
+		return 4
+	case *updater.ScheduleError:
+		return 5
+	}
+	return 2
+}
+
+func (c *UpdateCommand) queueRun(ctx context.Context, ws *updater.Workspace, result *updateResult, message string, wait bool, timeout time.Duration) int {
+	run, err := ws.QueueRun(ctx, message)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to queue a run: %s", err))
+		result.Error = err.Error()
+		return 2
+	}
+	c.UI.Info(fmt.Sprintf("Run: %s", ws.GetRunLink(run)))
+	result.Run = ws.GetRunLink(run)
+
+	if !wait {
+		return 0
+	}
+
+	run, err = ws.WaitRun(ctx, run, timeout, (*updater.Run).IsSettled)
+	if err != nil {
+		c.UI.Error(err.Error())
+		result.Error = err.Error()
+		return 2
+	}
+	if run.IsFinished() && !run.IsSucceeded() {
+		c.UI.Error(fmt.Sprintf("Run finished with status %s", run.Status))
+		result.Error = fmt.Sprintf("Run finished with status %s", run.Status)
+		return 2
+	}
+	c.UI.Info(fmt.Sprintf("Run status: %s", run.Status))
+	return 0
+}
+
 func (c *UpdateCommand) Help() string {
 	return strings.TrimSpace(helpMessageUpdate)
 }
@@ -94,9 +355,28 @@ Usage: terraform-cloud-updater update <version> [OPTION]
 Notes:
   version is must be in the correct semantic version format like 0.12.1, v0.12.2 .
   Or you can specify "latest" to automatically update to the latest version.
+  With --track, "latest" or a version constraint like "~> 0.12.0" is set to the workspace as is,
+  and Terraform Cloud moves the workspace to the newer version automatically.
+  Without --track, the workspace is pinned to the version.
+  With --project, the required version of the root path is checked only for the workspace of the root path,
+  because the other workspaces in the project have their own configurations.
+  The maintenance windows and the freezes in the policy file gate the update. Outside of them,
+  the workspace is not changed, the next allowed time is shown, and the exit code is 5.
+  With --notify, a notification is sent for the workspaces which are changed or fail to be changed.
 
 Options:
-  --token        Terraform Cloud token        (default: TFE_TOKEN env var or parse from your .terraformrc)
-  --root-path    Terraform config root path   (default: current directory)
+` + helpMessageGlobalOptions + `
+` + helpMessageOrganizationOptions + `
+` + helpMessageChangeOptions + `
+` + helpMessageNotifyOptions + `
+  --project                Update all the workspaces in the project, instead of the workspace of the root path
+  --track                  Set "latest" or a version constraint to the workspace, instead of pinning a version
+  --verify                 Verify the new version with a plan-only run on it, and update only if the plan succeeds
+  --queue-run              Queue a run after updating the version
+  --queue-run-message      Message of the queued run
+  --wait-run               Wait until the queued run finishes or needs a confirmation
+  --run-timeout            Timeout to wait for runs   (default: 30m)
+  --dry-run                Check everything including the workspace lock and runs, but don't change the workspace
+  --json                   Output the result in JSON
 
 `
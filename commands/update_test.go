@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+)
+
+func TestUpdateNotificationEvents(t *testing.T) {
+	results := []*updateResult{
+		{Workspace: "changed", CurrentVersion: "1.5.6", NewVersion: "1.6.0", Changed: true},
+		{Workspace: "failed", CurrentVersion: "1.5.6", NewVersion: "1.6.0", Error: "workspace is locked"},
+		{Workspace: "run-failed", CurrentVersion: "1.5.6", NewVersion: "1.6.0", Changed: true, Error: "Run finished with status errored"},
+		{Workspace: "already", CurrentVersion: "1.6.0", NewVersion: "1.6.0"},
+		{Workspace: "dry-run", CurrentVersion: "1.5.6", NewVersion: "1.6.0", WouldChange: true, DryRun: true},
+		{Error: "no workspace"},
+	}
+	expected := []string{"changed updated ", "failed failed workspace is locked", "run-failed updated Run finished with status errored"}
+
+	var got []string
+	for _, e := range updateNotificationEvents(results) {
+		got = append(got, fmt.Sprintf("%s %s %s", e.Workspace, e.Kind, e.Detail))
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Failed: want = %q / got = %q", expected, got)
+	}
+}
+
+func TestUpdateNotificationLinks(t *testing.T) {
+	cases := []struct {
+		hostname string
+		expected string
+	}{
+		{hostname: "", expected: "https://app.terraform.io/app/chroju/workspaces/network/settings/general"},
+		{hostname: "tfe.example.com", expected: "https://tfe.example.com/app/chroju/workspaces/network/settings/general"},
+	}
+
+	for _, v := range cases {
+		ws, err := updater.NewWorkspace(nil, &updater.Config{Hostname: v.hostname, Organization: "chroju", Workspace: "network"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := []*updateResult{{Workspace: ws.GetName(), Link: ws.GetSettingsLink(), CurrentVersion: "1.5.6", NewVersion: "1.6.0", Changed: true}}
+		events := updateNotificationEvents(results)
+		if len(events) != 1 || events[0].Link != v.expected {
+			t.Errorf("Failed: hostname = %s / want = %s / got = %+v", v.hostname, v.expected, events)
+		}
+	}
+}
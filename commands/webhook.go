@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+)
+
+// maxWebhookBody is the max size of the webhook body, which is enough for the release and notification payloads
+const maxWebhookBody = 5 << 20
+
+// terraformRepository is the repository whose GitHub releases trigger reconcile
+const terraformRepository = "hashicorp/terraform"
+
+// githubReleasePayload is the part of the GitHub release event payload used by serve
+type githubReleasePayload struct {
+	Action  string `json:"action"`
+	Release struct {
+		TagName string `json:"tag_name"`
+		Draft   bool   `json:"draft"`
+	} `json:"release"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// releasePayload is the payload of the generic new version webhook
+type releasePayload struct {
+	Version string `json:"version"`
+}
+
+// tfcNotificationPayload is the part of the Terraform Cloud run notification payload used by serve
+type tfcNotificationPayload struct {
+	RunID            string `json:"run_id"`
+	WorkspaceName    string `json:"workspace_name"`
+	OrganizationName string `json:"organization_name"`
+	Notifications    []struct {
+		Trigger   string `json:"trigger"`
+		RunStatus string `json:"run_status"`
+	} `json:"notifications"`
+}
+
+// webhook reads the body of the POST request, and verifies its HMAC signature with the secret.
+// It writes the error response and returns nil if the request is not acceptable.
+func webhook(w http.ResponseWriter, r *http.Request, secret, signature string, newHash func() hash.Hash) []byte {
+	if secret == "" {
+		http.Error(w, "webhook is not configured", http.StatusNotFound)
+		return nil
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	if !verifySignature(secret, body, signature, newHash) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return nil
+	}
+	return body
+}
+
+// verifySignature verifies the hex encoded HMAC signature of the body
+func verifySignature(secret string, body []byte, signature string, newHash func() hash.Hash) bool {
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(actual, mac.Sum(nil))
+}
+
+// githubWebhook receives the GitHub release events of hashicorp/terraform, signed in X-Hub-Signature-256
+func (s *server) githubWebhook(w http.ResponseWriter, r *http.Request) {
+	signature := strings.TrimPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	body := webhook(w, r, s.opts.githubSecret, signature, sha256.New)
+	if body == nil {
+		return
+	}
+
+	switch r.Header.Get("X-GitHub-Event") {
+	case "ping":
+		fmt.Fprintln(w, "pong")
+		return
+	case "release":
+	default:
+		fmt.Fprintln(w, "ignored")
+		return
+	}
+
+	var payload githubReleasePayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.Repository.FullName != terraformRepository || payload.Release.Draft || (payload.Action != "published" && payload.Action != "released") {
+		fmt.Fprintln(w, "ignored")
+		return
+	}
+
+	s.trigger(fmt.Sprintf("GitHub release %s", payload.Release.TagName), true)
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintln(w, "accepted")
+}
+
+// releaseWebhook receives the generic new version request like {"version": "1.5.7"}, signed in X-Signature-256
+func (s *server) releaseWebhook(w http.ResponseWriter, r *http.Request) {
+	signature := strings.TrimPrefix(r.Header.Get("X-Signature-256"), "sha256=")
+	body := webhook(w, r, s.opts.webhookSecret, signature, sha256.New)
+	if body == nil {
+		return
+	}
+
+	var payload releasePayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	v, err := updater.NewSemanticVersion(payload.Version)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid version %q", payload.Version), http.StatusBadRequest)
+		return
+	}
+	// pre-releases are never rolled out, like the ones GitHub lists
+	if v.Status != "" {
+		fmt.Fprintln(w, "ignored")
+		return
+	}
+
+	s.announce(v, time.Now())
+	s.trigger(fmt.Sprintf("new version %s", payload.Version), true)
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintln(w, "accepted")
+}
+
+// tfcWebhook receives the Terraform Cloud run notifications, signed in X-TFE-Notification-Signature
+func (s *server) tfcWebhook(w http.ResponseWriter, r *http.Request) {
+	body := webhook(w, r, s.opts.tfcToken, r.Header.Get("X-TFE-Notification-Signature"), sha512.New)
+	if body == nil {
+		return
+	}
+
+	var payload tfcNotificationPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, n := range payload.Notifications {
+		// the run has finished, so that the rollout may move on, or stop on the failure
+		if n.Trigger == "run:completed" || n.Trigger == "run:errored" {
+			s.trigger(fmt.Sprintf("run %s of %s/%s %s", payload.RunID, payload.OrganizationName, payload.WorkspaceName, n.RunStatus), false)
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintln(w, "accepted")
+			return
+		}
+	}
+	// including the verification request on creating the notification configuration
+	fmt.Fprintln(w, "ignored")
+}
@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chroju/terraform-cloud-updater/updater"
+	"github.com/mitchellh/cli"
+)
+
+func TestWebhookHandlers(t *testing.T) {
+	sign := func(secret, body string, newHash func() hash.Hash) string {
+		mac := hmac.New(newHash, []byte(secret))
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	release := `{"action": "published", "release": {"tag_name": "v1.5.7", "draft": false}, "repository": {"full_name": "hashicorp/terraform"}}`
+	otherRepo := `{"action": "published", "release": {"tag_name": "v1.0.0"}, "repository": {"full_name": "hashicorp/vault"}}`
+	completed := `{"run_id": "run-1", "workspace_name": "sample", "organization_name": "chroju", "notifications": [{"trigger": "run:completed", "run_status": "applied"}]}`
+	verification := `{"notifications": [{"trigger": "verification"}]}`
+
+	cases := []struct {
+		path       string
+		method     string
+		headers    map[string]string
+		body       string
+		status     int
+		triggered  bool
+		revalidate bool
+		announced  string
+	}{
+		{path: "/webhooks/github", method: "POST", headers: map[string]string{"X-GitHub-Event": "release", "X-Hub-Signature-256": "sha256=" + sign("github", release, sha256.New)}, body: release, status: http.StatusAccepted, triggered: true, revalidate: true},
+		{path: "/webhooks/github", method: "POST", headers: map[string]string{"X-GitHub-Event": "release", "X-Hub-Signature-256": "sha256=" + sign("wrong", release, sha256.New)}, body: release, status: http.StatusUnauthorized},
+		{path: "/webhooks/github", method: "POST", headers: map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": "sha256=" + sign("github", "{}", sha256.New)}, body: "{}", status: http.StatusOK},
+		{path: "/webhooks/github", method: "POST", headers: map[string]string{"X-GitHub-Event": "release", "X-Hub-Signature-256": "sha256=" + sign("github", otherRepo, sha256.New)}, body: otherRepo, status: http.StatusOK},
+		{path: "/webhooks/github", method: "GET", status: http.StatusMethodNotAllowed},
+		{path: "/webhooks/release", method: "POST", headers: map[string]string{"X-Signature-256": "sha256=" + sign("release", `{"version": "1.5.7"}`, sha256.New)}, body: `{"version": "1.5.7"}`, status: http.StatusAccepted, triggered: true, revalidate: true, announced: "1.5.7"},
+		{path: "/webhooks/release", method: "POST", headers: map[string]string{"X-Signature-256": "sha256=" + sign("release", `{"version": "latest"}`, sha256.New)}, body: `{"version": "latest"}`, status: http.StatusBadRequest},
+		{path: "/webhooks/release", method: "POST", headers: map[string]string{"X-Signature-256": "sha256=" + sign("release", `{"version": "1.6.0-beta1"}`, sha256.New)}, body: `{"version": "1.6.0-beta1"}`, status: http.StatusOK},
+		{path: "/webhooks/release", method: "POST", body: `{"version": "1.5.7"}`, status: http.StatusUnauthorized},
+		{path: "/webhooks/tfc", method: "POST", headers: map[string]string{"X-TFE-Notification-Signature": sign("tfc", completed, sha512.New)}, body: completed, status: http.StatusAccepted, triggered: true},
+		{path: "/webhooks/tfc", method: "POST", headers: map[string]string{"X-TFE-Notification-Signature": sign("tfc", verification, sha512.New)}, body: verification, status: http.StatusOK},
+		{path: "/webhooks/tfc", method: "POST", headers: map[string]string{"X-TFE-Notification-Signature": sign("tfc", completed, sha256.New)}, body: completed, status: http.StatusUnauthorized},
+	}
+
+	for _, v := range cases {
+		s := newServer(cli.NewMockUi(), &serveOptions{interval: 15 * time.Minute, githubSecret: "github", webhookSecret: "release", tfcToken: "tfc"})
+		ts := httptest.NewServer(s.handler())
+
+		req, err := http.NewRequest(v.method, ts.URL+v.path, strings.NewReader(v.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, h := range v.headers {
+			req.Header.Set(k, h)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		ts.Close()
+
+		triggered := false
+		select {
+		case <-s.triggers:
+			triggered = true
+		default:
+		}
+		if resp.StatusCode != v.status || triggered != v.triggered || s.revalidate != v.revalidate {
+			t.Errorf("Failed: path = %s / body = %s / want = %d triggered %t revalidate %t / got = %d triggered %t revalidate %t",
+				v.path, v.body, v.status, v.triggered, v.revalidate, resp.StatusCode, triggered, s.revalidate)
+		}
+		var announced []string
+		for _, r := range s.announced {
+			announced = append(announced, r.SemanticVersion.String())
+		}
+		if strings.Join(announced, ",") != v.announced {
+			t.Errorf("Failed: path = %s / body = %s / want announced = %s / got = %v", v.path, v.body, v.announced, announced)
+		}
+	}
+
+	// the webhooks without the secret are disabled
+	s := newServer(cli.NewMockUi(), &serveOptions{interval: 15 * time.Minute})
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+	resp, err := http.Post(ts.URL+"/webhooks/release", "application/json", strings.NewReader(`{"version": "1.5.7"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Failed: want = %d / got = %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestAnnouncedReleases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "releasesfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "releases.json")
+	if err = ioutil.WriteFile(path, []byte(`[{"tag_name": "v1.6.0"}, {"tag_name": "v1.5.6"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the version announced by the webhook is used in the next cycle, before GitHub lists it
+	s := newServer(cli.NewMockUi(), &serveOptions{interval: 15 * time.Minute})
+	v, _ := updater.NewSemanticVersion("1.5.7")
+	s.announce(v, time.Now())
+	s.announce(v, time.Now())
+
+	opts := &globalOptions{releasesFile: path, announced: s.announced}
+	releases, err := newTfReleases(opts, nil).List(context.Background())
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	var got []string
+	for _, r := range releases {
+		got = append(got, r.SemanticVersion.String())
+	}
+	if strings.Join(got, ",") != "1.6.0,1.5.7,1.5.6" {
+		t.Errorf("Failed: want = 1.6.0,1.5.7,1.5.6 / got = %v", got)
+	}
+
+	// the announced version is dropped once the source lists it
+	if announced := s.pruneAnnounced(context.Background(), opts); len(announced) != 1 {
+		t.Errorf("Failed: want = [1.5.7] / got = %v", announced)
+	}
+	if err = ioutil.WriteFile(path, []byte(`[{"tag_name": "v1.6.0"}, {"tag_name": "v1.5.7"}, {"tag_name": "v1.5.6"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if announced := s.pruneAnnounced(context.Background(), opts); len(announced) != 0 || len(s.announced) != 0 {
+		t.Errorf("Failed: want = [] / got = %v, %v", announced, s.announced)
+	}
+}
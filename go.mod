@@ -8,4 +8,5 @@ require (
 	github.com/mitchellh/cli v1.1.1
 	github.com/spf13/pflag v1.0.2
 	github.com/stretchr/testify v1.5.1 // indirect
+	github.com/zclconf/go-cty v1.2.0
 )
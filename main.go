@@ -29,6 +29,27 @@ func main() {
 		"update": func() (cli.Command, error) {
 			return &commands.UpdateCommand{UI: &cli.ColoredUi{Ui: ui, WarnColor: cli.UiColorYellow, ErrorColor: cli.UiColorRed}}, nil
 		},
+		"rollback": func() (cli.Command, error) {
+			return &commands.RollbackCommand{UI: &cli.ColoredUi{Ui: ui, WarnColor: cli.UiColorYellow, ErrorColor: cli.UiColorRed}}, nil
+		},
+		"sync": func() (cli.Command, error) {
+			return &commands.SyncCommand{UI: &cli.ColoredUi{Ui: ui, WarnColor: cli.UiColorYellow, ErrorColor: cli.UiColorRed}}, nil
+		},
+		"audit": func() (cli.Command, error) {
+			return &commands.AuditCommand{UI: &cli.ColoredUi{Ui: ui, WarnColor: cli.UiColorYellow, ErrorColor: cli.UiColorRed}}, nil
+		},
+		"reconcile": func() (cli.Command, error) {
+			return &commands.ReconcileCommand{UI: &cli.ColoredUi{Ui: ui, WarnColor: cli.UiColorYellow, ErrorColor: cli.UiColorRed}}, nil
+		},
+		"rollout": func() (cli.Command, error) {
+			return &commands.RolloutCommand{UI: &cli.ColoredUi{Ui: ui, WarnColor: cli.UiColorYellow, ErrorColor: cli.UiColorRed}}, nil
+		},
+		"serve": func() (cli.Command, error) {
+			return &commands.ServeCommand{UI: &cli.ColoredUi{Ui: ui, WarnColor: cli.UiColorYellow, ErrorColor: cli.UiColorRed}}, nil
+		},
+		"export-releases": func() (cli.Command, error) {
+			return &commands.ExportReleasesCommand{UI: &cli.ColoredUi{Ui: ui, WarnColor: cli.UiColorYellow, ErrorColor: cli.UiColorRed}}, nil
+		},
 	}
 
 	exitStatus, err := c.Run()
@@ -0,0 +1,134 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	tfe "github.com/hashicorp/go-tfe"
+)
+
+// apiDocument is a JSON:API document with a single resource
+type apiDocument struct {
+	Data *apiResource `json:"data"`
+}
+
+// apiListDocument is a JSON:API document with a page of resources
+type apiListDocument struct {
+	Data []*apiResource `json:"data"`
+	Meta struct {
+		Pagination struct {
+			NextPage int `json:"next-page"`
+		} `json:"pagination"`
+	} `json:"meta"`
+}
+
+// apiResource is a JSON:API resource object
+type apiResource struct {
+	ID            string                     `json:"id,omitempty"`
+	Type          string                     `json:"type"`
+	Attributes    map[string]interface{}     `json:"attributes,omitempty"`
+	Relationships map[string]apiRelationship `json:"relationships,omitempty"`
+}
+
+// apiRelationship is a JSON:API to-one relationship
+type apiRelationship struct {
+	Data *apiResource `json:"data"`
+}
+
+// UnmarshalJSON ignores to-many relationships, which are not used
+func (r *apiRelationship) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw.Data) == 0 || raw.Data[0] != '{' {
+		return nil
+	}
+	return json.Unmarshal(raw.Data, &r.Data)
+}
+
+func (r *apiResource) stringsAttribute(name string) []string {
+	values, _ := r.Attributes[name].([]interface{})
+	var result []string
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func (r *apiResource) stringAttribute(name string) string {
+	if v, ok := r.Attributes[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// apiRequest calls the Terraform Cloud API directly, for the features which go-tfe doesn't support.
+// in and out are marshaled and unmarshaled as JSON if they are not nil.
+func (t *tfcloudImpl) apiRequest(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, t.address+tfe.DefaultBasePath+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return tfe.ErrResourceNotFound
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("%s %s failed: %s", method, path, resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// apiList lists all the resources of the path, following the pagination.
+// query is the query string without the page parameters, like "filter[names]=foo".
+func (t *tfcloudImpl) apiList(ctx context.Context, path string, query url.Values) ([]*apiResource, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("page[size]", "100")
+
+	var resources []*apiResource
+	for page := 1; page > 0; {
+		query.Set("page[number]", strconv.Itoa(page))
+		var out apiListDocument
+		if err := t.apiRequest(ctx, http.MethodGet, path+"?"+query.Encode(), nil, &out); err != nil {
+			return nil, err
+		}
+		resources = append(resources, out.Data...)
+		page = out.Meta.Pagination.NextPage
+	}
+	return resources, nil
+}
@@ -0,0 +1,76 @@
+package updater
+
+import (
+	"context"
+	"errors"
+)
+
+// Audit statuses of the workspace
+const (
+	AuditOK              = "ok"
+	AuditOutdated        = "outdated"
+	AuditPolicyViolation = "policy_violation"
+	AuditUnknownVersion  = "unknown_version"
+	AuditError           = "error"
+)
+
+// AuditResult is the version status of the workspace
+type AuditResult struct {
+	Organization string `json:"organization"`
+	Workspace    string `json:"workspace"`
+	Version      string `json:"version"`
+	// ResolvedVersion is the version which "latest" or the version constraint resolves to
+	ResolvedVersion string `json:"resolved_version,omitempty"`
+	// LatestVersion is the latest version compatible with the required versions
+	LatestVersion  string `json:"latest_version,omitempty"`
+	DefaultVersion string `json:"default_version,omitempty"`
+	Status         string `json:"status"`
+	Error          string `json:"error,omitempty"`
+}
+
+// Audit checks whether the workspace is up to date, and follows the policy.
+// Errors are not returned but recorded in the result, so that one workspace doesn't stop auditing others.
+func (w *Workspace) Audit(ctx context.Context, p *Policy) *AuditResult {
+	result := &AuditResult{Organization: w.organization, Workspace: w.workspace}
+	fail := func(status string, err error) *AuditResult {
+		result.Status = status
+		result.Error = err.Error()
+		return result
+	}
+
+	current, err := w.GetWorkspaceVersion(ctx)
+	var parseErr *VersionParseError
+	if errors.As(err, &parseErr) {
+		result.Version = parseErr.Raw
+		return fail(AuditUnknownVersion, err)
+	} else if err != nil {
+		return fail(AuditError, err)
+	}
+	result.Version = current.String()
+
+	resolved, err := w.ResolveWorkspaceVersion(ctx, current)
+	if err != nil {
+		return fail(AuditError, err)
+	}
+	result.ResolvedVersion = resolved.String()
+
+	latest, err := w.GetCompatibleLatestVersion(ctx)
+	if err != nil {
+		return fail(AuditError, err)
+	}
+	result.LatestVersion = latest.String()
+
+	err = w.CheckPolicy(ctx, p)
+	if violation, ok := err.(*PolicyViolation); ok {
+		result.DefaultVersion = violation.Policy.DefaultVersion.String()
+		return fail(AuditPolicyViolation, err)
+	} else if err != nil {
+		return fail(AuditError, err)
+	}
+
+	result.Status = AuditOK
+	if resolved.Compare(latest) < 0 {
+		result.Status = AuditOutdated
+	}
+	return result
+}
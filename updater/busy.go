@@ -0,0 +1,113 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// BusyPolicy is how to handle the workspace which is locked or has an active run when changing the version
+type BusyPolicy string
+
+const (
+	// BusyAbort aborts the change
+	BusyAbort BusyPolicy = "abort"
+	// BusyWait waits until the workspace is idle
+	BusyWait BusyPolicy = "wait"
+	// BusyLock waits until the active run finishes, and locks the workspace during the change
+	BusyLock BusyPolicy = "lock"
+)
+
+// busyPollInterval is the interval to poll the workspace status
+var busyPollInterval = 10 * time.Second
+
+// NewBusyPolicy returns the BusyPolicy from the given string
+func NewBusyPolicy(s string) (BusyPolicy, error) {
+	switch p := BusyPolicy(s); p {
+	case BusyAbort, BusyWait, BusyLock:
+		return p, nil
+	}
+	return "", fmt.Errorf("%s is not valid, it must be one of abort, wait and lock", s)
+}
+
+// WorkspaceStatus represents Terraform Cloud workspace lock and run status
+type WorkspaceStatus struct {
+	Locked     bool
+	CurrentRun *Run
+}
+
+// IsBusy returns whether the workspace is locked or has an active run
+func (s *WorkspaceStatus) IsBusy() bool {
+	return s.Locked || s.HasActiveRun()
+}
+
+// HasActiveRun returns whether the current run is in progress or waiting for a confirmation
+func (s *WorkspaceStatus) HasActiveRun() bool {
+	return s.CurrentRun != nil && !s.CurrentRun.IsFinished()
+}
+
+// BusyError is returned when the workspace is locked or has an active run
+type BusyError struct {
+	Workspace string
+	Status    *WorkspaceStatus
+}
+
+func (e *BusyError) Error() string {
+	if e.Status.Locked {
+		return fmt.Sprintf("Workspace %s is locked", e.Workspace)
+	}
+	return fmt.Sprintf("Workspace %s has an active run %s (status: %s)", e.Workspace, e.Status.CurrentRun.ID, e.Status.CurrentRun.Status)
+}
+
+// SetBusyPolicy sets how to handle the busy workspace, and how long to wait for it
+func (w *Workspace) SetBusyPolicy(p BusyPolicy, timeout time.Duration) {
+	w.busyPolicy = p
+	w.busyTimeout = timeout
+}
+
+// whenIdle calls f when the workspace is neither locked nor has an active run, according to the busy policy.
+// In the dry run mode, only the workspace status is checked and f is not called.
+func (w *Workspace) whenIdle(ctx context.Context, f func() error) error {
+	busy := func(s *WorkspaceStatus) bool {
+		if w.busyPolicy == BusyLock {
+			return s.HasActiveRun()
+		}
+		return s.IsBusy()
+	}
+
+	deadline := time.Now().Add(w.busyTimeout)
+	for {
+		status, err := w.client.ReadWorkspaceStatus(ctx, w.organization, w.workspace)
+		if err != nil {
+			return err
+		}
+
+		if !busy(status) {
+			break
+		}
+		if w.busyPolicy == BusyAbort || w.busyPolicy == "" || time.Now().After(deadline) {
+			return &BusyError{Workspace: w.workspace, Status: status}
+		}
+		if err := sleep(ctx, busyPollInterval); err != nil {
+			return err
+		}
+	}
+
+	if w.dryRun {
+		return nil
+	}
+	if w.busyPolicy != BusyLock {
+		return f()
+	}
+
+	if err := w.client.LockWorkspace(ctx, w.organization, w.workspace, "Updating Terraform version by terraform-cloud-updater"); err != nil {
+		return fmt.Errorf("Failed to lock workspace %s: %s", w.workspace, err)
+	}
+	err := f()
+	cleanupCtx, cancel := newCleanupContext()
+	defer cancel()
+	if unlockErr := w.client.UnlockWorkspace(cleanupCtx, w.organization, w.workspace); unlockErr != nil && err == nil {
+		err = fmt.Errorf("Failed to unlock workspace %s: %s", w.workspace, unlockErr)
+	}
+	return err
+}
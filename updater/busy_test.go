@@ -0,0 +1,103 @@
+package updater
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUpdateVersionWhenBusy(t *testing.T) {
+	busyPollInterval = time.Millisecond
+
+	active := &Run{ID: "run-active", Status: "applying"}
+	applied := &Run{ID: "run-active", Status: RunApplied}
+	cases := []struct {
+		policy        BusyPolicy
+		statuses      []*WorkspaceStatus
+		expectError   bool
+		expectedLocks []bool
+	}{
+		{
+			policy:      BusyAbort,
+			statuses:    []*WorkspaceStatus{{Locked: true}},
+			expectError: true,
+		},
+		{
+			policy:   BusyAbort,
+			statuses: []*WorkspaceStatus{{CurrentRun: applied}},
+		},
+		{
+			policy:   BusyWait,
+			statuses: []*WorkspaceStatus{{CurrentRun: active}, {Locked: true}, {CurrentRun: applied}},
+		},
+		{
+			policy:      BusyWait,
+			statuses:    []*WorkspaceStatus{{CurrentRun: active}},
+			expectError: true,
+		},
+		{
+			policy:        BusyLock,
+			statuses:      []*WorkspaceStatus{{CurrentRun: active}, {CurrentRun: applied}},
+			expectedLocks: []bool{true, false},
+		},
+	}
+
+	for _, v := range cases {
+		client := &TfCloudMock{
+			version:  &SemanticVersion{Versions: []int{0, 12, 20}},
+			statuses: v.statuses,
+		}
+		w := &Workspace{client: client, workspace: "sample"}
+		w.SetBusyPolicy(v.policy, 50*time.Millisecond)
+
+		err := w.UpdateVersion(context.Background(), &SemanticVersion{Versions: []int{0, 12, 25}})
+		if _, ok := err.(*BusyError); ok != v.expectError {
+			t.Errorf("Failed: policy = %s / want busy error = %v / got = %v", v.policy, v.expectError, err)
+		}
+		if !reflect.DeepEqual(client.locks, v.expectedLocks) {
+			t.Errorf("Failed: policy = %s / want locks = %v / got = %v", v.policy, v.expectedLocks, client.locks)
+		}
+	}
+}
+
+func TestUpdateVersionDryRun(t *testing.T) {
+	busyPollInterval = time.Millisecond
+
+	cases := []struct {
+		policy      BusyPolicy
+		statuses    []*WorkspaceStatus
+		state       *SemanticVersion
+		expectError bool
+	}{
+		{
+			policy: BusyLock,
+		},
+		{
+			policy:      BusyAbort,
+			statuses:    []*WorkspaceStatus{{Locked: true}},
+			expectError: true,
+		},
+		{
+			policy:      BusyAbort,
+			state:       &SemanticVersion{Versions: []int{0, 13, 0}},
+			expectError: true,
+		},
+	}
+
+	for _, v := range cases {
+		initial := &SemanticVersion{Versions: []int{0, 12, 20}}
+		client := &TfCloudMock{version: initial, statuses: v.statuses, state: v.state}
+		w := &Workspace{client: client, workspace: "sample"}
+		w.SetBusyPolicy(v.policy, 10*time.Millisecond)
+		w.SetDryRun(true)
+
+		err := w.UpdateVersion(context.Background(), &SemanticVersion{Versions: []int{0, 12, 25}})
+		if (err != nil) != v.expectError {
+			t.Errorf("Failed: policy = %s / want error = %v / got = %v", v.policy, v.expectError, err)
+		}
+		if client.version != initial || len(client.locks) != 0 {
+			t.Errorf("Failed: policy = %s / workspace is changed in dry run / version = %v / locks = %v", v.policy, client.version, client.locks)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package updater
+
+import (
+	"context"
+	"errors"
+)
+
+// DriftResult is how far the workspace is behind the latest stable release
+type DriftResult struct {
+	Organization string `json:"organization"`
+	Workspace    string `json:"workspace"`
+	// Version is the version which the workspace currently resolves to, or the raw version if it can't be parsed
+	Version       string `json:"version"`
+	LatestVersion string `json:"latest_version,omitempty"`
+	// MajorsBehind is the number of newer major versions
+	MajorsBehind int `json:"majors_behind"`
+	// MinorsBehind is the number of newer minor versions, including the ones in the newer major versions
+	MinorsBehind int `json:"minors_behind"`
+	// PatchesBehind is the number of newer patch versions in the same minor version
+	PatchesBehind int `json:"patches_behind"`
+	// Compatible is whether the version is compatible with the required versions
+	Compatible bool   `json:"compatible"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Drift counts the stable releases newer than the version of the workspace.
+// Errors are not returned but recorded in the result, so that one workspace doesn't stop measuring others.
+func (w *Workspace) Drift(ctx context.Context) *DriftResult {
+	result := &DriftResult{Organization: w.organization, Workspace: w.workspace}
+
+	current, err := w.GetWorkspaceVersion(ctx)
+	var parseErr *VersionParseError
+	if errors.As(err, &parseErr) {
+		result.Version = parseErr.Raw
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	resolved, err := w.ResolveWorkspaceVersion(ctx, current)
+	if err != nil {
+		result.Version = current.String()
+		result.Error = err.Error()
+		return result
+	}
+	result.Version = resolved.String()
+	result.Compatible = w.IsCompatibleVersion(resolved)
+
+	releases, err := w.tfRelease.List(ctx)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	majors := map[int]bool{}
+	minors := map[[2]int]bool{}
+	for _, v := range releases {
+		s := v.SemanticVersion
+		if v.Draft || !isStableRelease(v) || s.Compare(resolved) <= 0 {
+			continue
+		}
+
+		major, minor := versionPart(s, 0), versionPart(s, 1)
+		if major > versionPart(resolved, 0) {
+			majors[major] = true
+		}
+		if major != versionPart(resolved, 0) || minor != versionPart(resolved, 1) {
+			minors[[2]int{major, minor}] = true
+		} else {
+			result.PatchesBehind++
+		}
+	}
+	result.MajorsBehind = len(majors)
+	result.MinorsBehind = len(minors)
+	result.LatestVersion = resolved.String()
+	if latest := greatestRelease(releases, isStableRelease); latest != nil && latest.Compare(resolved) > 0 {
+		result.LatestVersion = latest.String()
+	}
+	return result
+}
@@ -0,0 +1,87 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDrift(t *testing.T) {
+	release := func(v string) *TfRelease {
+		s, _ := NewSemanticVersion(v)
+		return &TfRelease{Tag: "v" + v, SemanticVersion: s}
+	}
+	releases := []*TfRelease{
+		release("2.0.0-beta1"),
+		release("1.6.1"),
+		release("1.6.0"),
+		release("1.5.7"),
+		release("1.5.6"),
+		release("1.4.0"),
+		release("0.15.5"),
+		release("0.14.0"),
+	}
+	required, err := NewRequiredVersions(">= 1.5.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		version  string
+		expected DriftResult
+	}{
+		{version: "1.6.1", expected: DriftResult{Version: "1.6.1", LatestVersion: "1.6.1", Compatible: true}},
+		{version: "1.5.6", expected: DriftResult{Version: "1.5.6", LatestVersion: "1.6.1", MinorsBehind: 1, PatchesBehind: 1, Compatible: true}},
+		{version: "0.14.0", expected: DriftResult{Version: "0.14.0", LatestVersion: "1.6.1", MajorsBehind: 1, MinorsBehind: 4}},
+		// "latest" is measured by the version it resolves to
+		{version: "latest", expected: DriftResult{Version: "1.6.1", LatestVersion: "1.6.1", Compatible: true}},
+		{version: "~> 1.5.0", expected: DriftResult{Version: "1.5.7", LatestVersion: "1.6.1", MinorsBehind: 1, Compatible: true}},
+	}
+
+	for _, v := range cases {
+		wv, err := NewWorkspaceVersion(v.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &TfCloudMock{workspaceVersion: wv}
+		w := &Workspace{client: client, tfRelease: &tfReleasesImpl{releases: releases}, requiredVersions: required, organization: "chroju", workspace: "sample"}
+
+		got := w.Drift(context.Background())
+		v.expected.Organization, v.expected.Workspace = "chroju", "sample"
+		if *got != v.expected {
+			t.Errorf("Failed: version = %s / want = %+v / got = %+v", v.version, v.expected, got)
+		}
+	}
+}
+
+func TestDriftPaginated(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.Write([]byte(`[{"tag_name": "v1.5.7"}, {"tag_name": "v1.5.6"}, {"tag_name": "v1.4.0"}]`))
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s/releases?per_page=100&page=2>; rel="next"`, r.Host))
+		// a patch of the old version is released after the newer ones
+		w.Write([]byte(`[{"tag_name": "v1.4.1"}, {"tag_name": "v1.6.1"}, {"tag_name": "v1.6.0"}]`))
+	}))
+	defer ts.Close()
+
+	wv, err := NewWorkspaceVersion("1.4.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Workspace{
+		client:       &TfCloudMock{workspaceVersion: wv},
+		tfRelease:    &tfReleasesImpl{httpClient: http.DefaultClient, url: ts.URL + "/releases"},
+		organization: "chroju",
+		workspace:    "sample",
+	}
+
+	got := w.Drift(context.Background())
+	expected := DriftResult{Organization: "chroju", Workspace: "sample", Version: "1.4.0", LatestVersion: "1.6.1", MinorsBehind: 2, PatchesBehind: 1, Compatible: true}
+	if *got != expected {
+		t.Errorf("Failed: want = %+v / got = %+v", expected, got)
+	}
+}
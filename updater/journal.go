@@ -0,0 +1,106 @@
+package updater
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Journal records the terraform version changes made by this tool
+type Journal interface {
+	Record(entry *JournalEntry) error
+	// Last returns the last change of the workspace which is not rolled back
+	Last(hostname, org, workspace string) (*JournalEntry, error)
+}
+
+// JournalEntry is a terraform version change of a workspace.
+// The workspace is identified by the hostname too, because Terraform Enterprise may have the same organization and workspace names.
+type JournalEntry struct {
+	Time         time.Time `json:"time"`
+	Hostname     string    `json:"hostname"`
+	Organization string    `json:"organization"`
+	Workspace    string    `json:"workspace"`
+	From         string    `json:"from"`
+	To           string    `json:"to"`
+	// Rollback is true if the change rolls back the last change which is not rolled back yet
+	Rollback bool `json:"rollback,omitempty"`
+}
+
+type fileJournal struct {
+	path string
+}
+
+// NewFileJournal creates a new Journal which is saved in the local JSON file
+func NewFileJournal(path string) Journal {
+	return &fileJournal{path: path}
+}
+
+// DefaultJournalPath returns the journal path under $XDG_DATA_HOME
+func DefaultJournalPath() string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return filepath.Join(dataHome, "terraform-cloud-updater", "journal.json")
+}
+
+func (j *fileJournal) read() ([]*JournalEntry, error) {
+	b, err := ioutil.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []*JournalEntry
+	if err = json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Record appends the entry to the journal file
+func (j *fileJournal) Record(entry *JournalEntry) error {
+	entries, err := j.read()
+	if err != nil {
+		return err
+	}
+	entries = append(entries, entry)
+
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(j.path, b, 0644)
+}
+
+// Last returns the last change of the workspace which is not rolled back, or nil if there is no such change.
+// Each rollback cancels the change before it, so that the rollbacks go back through the changes one by one.
+func (j *fileJournal) Last(hostname, org, workspace string) (*JournalEntry, error) {
+	entries, err := j.read()
+	if err != nil {
+		return nil, err
+	}
+
+	rollbacks := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Hostname != hostname || e.Organization != org || e.Workspace != workspace {
+			continue
+		}
+		switch {
+		case e.Rollback:
+			rollbacks++
+		case rollbacks > 0:
+			rollbacks--
+		default:
+			return e, nil
+		}
+	}
+	return nil, nil
+}
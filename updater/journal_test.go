@@ -0,0 +1,112 @@
+package updater
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfc-updater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &TfCloudMock{version: &SemanticVersion{Versions: []int{0, 12, 20}}}
+	w := &Workspace{
+		client:       client,
+		hostname:     "app.terraform.io",
+		organization: "chroju",
+		workspace:    "sample",
+	}
+	w.SetJournal(NewFileJournal(filepath.Join(dir, "journal", "journal.json")))
+
+	from, to, err := w.GetPreviousVersion()
+	if err != nil || from != nil || to != nil {
+		t.Errorf("Failed: want no previous version / got = %v, %v, %v", from, to, err)
+	}
+
+	updates := []*SemanticVersion{
+		{Versions: []int{0, 12, 24}},
+		{Versions: []int{0, 12, 24}},
+		{Versions: []int{0, 12, 25}},
+	}
+	for _, v := range updates {
+		if err := w.UpdateVersion(context.Background(), v); err != nil {
+			t.Fatalf("Failed of error: %s", err)
+		}
+	}
+
+	// another workspace must not affect
+	other := &Workspace{client: client, hostname: "app.terraform.io", organization: "chroju", workspace: "other", journal: w.journal}
+	if err := other.UpdateVersion(context.Background(), &SemanticVersion{Versions: []int{0, 12, 20}}); err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+
+	from, to, err = w.GetPreviousVersion()
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if expected := (&SemanticVersion{Versions: []int{0, 12, 24}}); !reflect.DeepEqual(from.GetPinnedVersion(), expected) {
+		t.Errorf("Failed: want from = %v / got = %v", expected, from)
+	}
+	if expected := (&SemanticVersion{Versions: []int{0, 12, 25}}); !reflect.DeepEqual(to.GetPinnedVersion(), expected) {
+		t.Errorf("Failed: want to = %v / got = %v", expected, to)
+	}
+}
+
+func TestJournalRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfc-updater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	journal := NewFileJournal(filepath.Join(dir, "journal.json"))
+
+	client := &TfCloudMock{version: &SemanticVersion{Versions: []int{0, 12, 20}}}
+	w := &Workspace{client: client, hostname: "app.terraform.io", organization: "chroju", workspace: "sample", journal: journal}
+	for _, v := range []string{"0.12.24", "0.12.25"} {
+		s, _ := NewSemanticVersion(v)
+		if err := w.UpdateVersion(context.Background(), s); err != nil {
+			t.Fatalf("Failed of error: %s", err)
+		}
+	}
+
+	// the same names on another host must not affect
+	tfe := &Workspace{client: &TfCloudMock{version: &SemanticVersion{Versions: []int{0, 12, 20}}}, hostname: "tfe.example.com", organization: "chroju", workspace: "sample", journal: journal}
+	if err := tfe.UpdateVersion(context.Background(), &SemanticVersion{Versions: []int{0, 12, 23}}); err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+
+	// each rollback goes back one change, instead of switching between the last two versions
+	for _, expected := range []string{"0.12.24", "0.12.20", ""} {
+		from, _, err := w.GetPreviousVersion()
+		if err != nil {
+			t.Fatalf("Failed of error: %s", err)
+		}
+		if expected == "" {
+			if from != nil {
+				t.Errorf("Failed: want no previous version / got = %s", from)
+			}
+			break
+		}
+		if from == nil || from.String() != expected {
+			t.Fatalf("Failed: want = %s / got = %v", expected, from)
+		}
+		if err := w.RollbackWorkspaceVersion(context.Background(), from); err != nil {
+			t.Fatalf("Failed of error: %s", err)
+		}
+	}
+	if client.version.String() != "0.12.20" {
+		t.Errorf("Failed: want version = 0.12.20 / got = %s", client.version)
+	}
+
+	from, to, err := tfe.GetPreviousVersion()
+	if err != nil || from.String() != "0.12.20" || to.String() != "0.12.23" {
+		t.Errorf("Failed: want = 0.12.20, 0.12.23 / got = %v, %v, %v", from, to, err)
+	}
+}
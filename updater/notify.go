@@ -0,0 +1,243 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Notification event kinds
+const (
+	// NotifyAvailable is a new version available for the workspace
+	NotifyAvailable = "available"
+	// NotifyUpdated is the workspace changed to the new version
+	NotifyUpdated = "updated"
+	// NotifyFailed is the workspace which failed to be changed to the new version
+	NotifyFailed = "failed"
+)
+
+// Notifier kinds
+const (
+	NotifierSlack   = "slack"
+	NotifierTeams   = "teams"
+	NotifierWebhook = "webhook"
+)
+
+// DefaultNotifyGroupThreshold is the number of the events which are sent as separate messages.
+// More events are grouped into one message.
+const DefaultNotifyGroupThreshold = 3
+
+// DefaultNotificationTemplate is the text/template of the message text, which is executed with NotificationMessage
+const DefaultNotificationTemplate = `{{.Title}}
+{{range .Groups}}
+{{.Summary}}
+{{range .Events}}- {{.Organization}}/{{.Workspace}}{{if .Detail}}: {{.Detail}}{{end}}
+  {{.Link}}
+{{end}}{{end}}`
+
+// NotificationEvent is a version change of the workspace to notify
+type NotificationEvent struct {
+	Kind           string `json:"kind"`
+	Organization   string `json:"organization"`
+	Workspace      string `json:"workspace"`
+	CurrentVersion string `json:"current_version"`
+	NewVersion     string `json:"new_version"`
+	// Link is the URL of the version settings of the workspace
+	Link string `json:"link"`
+	// Detail is the error of the failed event, or the warning like the incompatible required versions
+	Detail string `json:"detail,omitempty"`
+}
+
+// Summary describes the kind and the versions of the event, like "Updated Terraform 1.5.6 -> 1.6.0"
+func (e *NotificationEvent) Summary() string {
+	switch e.Kind {
+	case NotifyAvailable:
+		return fmt.Sprintf("Terraform %s is available (current: %s)", e.NewVersion, e.CurrentVersion)
+	case NotifyUpdated:
+		return fmt.Sprintf("Updated Terraform %s -> %s", e.CurrentVersion, e.NewVersion)
+	case NotifyFailed:
+		return fmt.Sprintf("Failed to update Terraform %s -> %s", e.CurrentVersion, e.NewVersion)
+	}
+	return fmt.Sprintf("%s Terraform %s -> %s", e.Kind, e.CurrentVersion, e.NewVersion)
+}
+
+// NotificationGroup is the events with the same kind and versions
+type NotificationGroup struct {
+	Summary string               `json:"summary"`
+	Events  []*NotificationEvent `json:"events"`
+}
+
+// NotificationMessage is a message sent to the notifiers
+type NotificationMessage struct {
+	Title  string               `json:"title"`
+	Groups []*NotificationGroup `json:"groups"`
+	// Text is the message rendered by the template
+	Text string `json:"text"`
+}
+
+// Notifier sends the message to a chat or a webhook
+type Notifier interface {
+	Notify(ctx context.Context, m *NotificationMessage) error
+}
+
+type webhookNotifier struct {
+	httpClient *http.Client
+	kind       string
+	url        string
+}
+
+// NewNotifier creates new Notifier which posts the message to the Slack or Microsoft Teams incoming webhook,
+// or the message itself in JSON to the generic webhook.
+// http.DefaultClient is used if httpClient is nil.
+func NewNotifier(kind, url string, httpClient *http.Client) (Notifier, error) {
+	switch kind {
+	case NotifierSlack, NotifierTeams, NotifierWebhook:
+	default:
+		return nil, fmt.Errorf("unknown notifier %q, must be one of slack, teams or webhook", kind)
+	}
+	if url == "" {
+		return nil, fmt.Errorf("URL of the %s notifier is empty", kind)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &webhookNotifier{httpClient: httpClient, kind: kind, url: url}, nil
+}
+
+// Notify posts the message
+func (n *webhookNotifier) Notify(ctx context.Context, m *NotificationMessage) error {
+	var payload interface{}
+	switch n.kind {
+	case NotifierSlack:
+		payload = map[string]string{"text": m.Text}
+	case NotifierTeams:
+		payload = map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  m.Title,
+			// Teams needs two spaces before the line break in the markdown
+			"text": strings.Replace(m.Text, "\n", "  \n", -1),
+		}
+	default:
+		payload = m
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// read the body to reuse the connection
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to send the notification to %s: %s", n.kind, resp.Status)
+	}
+	return nil
+}
+
+// Notifications builds the messages from the events, and sends them to the notifiers
+type Notifications struct {
+	notifiers      []Notifier
+	template       *template.Template
+	groupThreshold int
+}
+
+// NewNotifications creates new Notifications.
+// DefaultNotificationTemplate is used if tmpl is empty.
+// Up to groupThreshold events are sent as separate messages, and more events are grouped into one message.
+func NewNotifications(notifiers []Notifier, tmpl string, groupThreshold int) (*Notifications, error) {
+	if tmpl == "" {
+		tmpl = DefaultNotificationTemplate
+	}
+	t, err := template.New("notification").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification template: %s", err)
+	}
+	return &Notifications{notifiers: notifiers, template: t, groupThreshold: groupThreshold}, nil
+}
+
+// Send sends the events to all the notifiers.
+// It tries all of them even if some fail, and returns the first error.
+func (n *Notifications) Send(ctx context.Context, events []*NotificationEvent) error {
+	if len(events) == 0 || len(n.notifiers) == 0 {
+		return nil
+	}
+
+	messages, err := n.messages(events)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, m := range messages {
+		for _, notifier := range n.notifiers {
+			if err := notifier.Notify(ctx, m); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// messages builds a message for each event, or one message which groups the events by the summary
+func (n *Notifications) messages(events []*NotificationEvent) ([]*NotificationMessage, error) {
+	var messages []*NotificationMessage
+	if len(events) <= n.groupThreshold {
+		for _, e := range events {
+			messages = append(messages, &NotificationMessage{
+				Title:  fmt.Sprintf("terraform-cloud-updater: %s/%s", e.Organization, e.Workspace),
+				Groups: []*NotificationGroup{{Summary: e.Summary(), Events: []*NotificationEvent{e}}},
+			})
+		}
+	} else {
+		m := &NotificationMessage{}
+		groups := map[string]*NotificationGroup{}
+		counts := map[string]int{}
+		for _, e := range events {
+			counts[e.Kind]++
+			summary := e.Summary()
+			g, ok := groups[summary]
+			if !ok {
+				g = &NotificationGroup{Summary: summary}
+				groups[summary] = g
+				m.Groups = append(m.Groups, g)
+			}
+			g.Events = append(g.Events, e)
+		}
+
+		var kinds []string
+		for kind, count := range counts {
+			kinds = append(kinds, fmt.Sprintf("%d %s", count, kind))
+		}
+		sort.Strings(kinds)
+		m.Title = fmt.Sprintf("terraform-cloud-updater: %d workspaces (%s)", len(events), strings.Join(kinds, ", "))
+		messages = append(messages, m)
+	}
+
+	for _, m := range messages {
+		var buf bytes.Buffer
+		if err := n.template.Execute(&buf, m); err != nil {
+			return nil, fmt.Errorf("failed to render the notification: %s", err)
+		}
+		m.Text = buf.String()
+	}
+	return messages, nil
+}
@@ -0,0 +1,176 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// notificationSink is a local HTTP server which records the posted bodies
+type notificationSink struct {
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+	status int
+}
+
+func (s *notificationSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil || r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bodies = append(s.bodies, payload)
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	event := func(kind, workspace, from, to string) *NotificationEvent {
+		return &NotificationEvent{
+			Kind:           kind,
+			Organization:   "chroju",
+			Workspace:      workspace,
+			CurrentVersion: from,
+			NewVersion:     to,
+			Link:           "https://app.terraform.io/app/chroju/workspaces/" + workspace + "/settings/general",
+		}
+	}
+	failed := event(NotifyFailed, "app", "1.5.6", "1.6.0")
+	failed.Detail = "workspace is locked"
+
+	cases := []struct {
+		name     string
+		kind     string
+		template string
+		events   []*NotificationEvent
+		key      string
+		expected []string
+	}{
+		{
+			name:   "slack",
+			kind:   NotifierSlack,
+			events: []*NotificationEvent{event(NotifyUpdated, "network", "1.5.6", "1.6.0")},
+			key:    "text",
+			expected: []string{
+				"terraform-cloud-updater: chroju/network\n\nUpdated Terraform 1.5.6 -> 1.6.0\n- chroju/network\n  https://app.terraform.io/app/chroju/workspaces/network/settings/general\n",
+			},
+		},
+		{
+			name:   "teams",
+			kind:   NotifierTeams,
+			events: []*NotificationEvent{failed},
+			key:    "text",
+			expected: []string{
+				"terraform-cloud-updater: chroju/app  \n  \nFailed to update Terraform 1.5.6 -> 1.6.0  \n- chroju/app: workspace is locked  \n  https://app.terraform.io/app/chroju/workspaces/app/settings/general  \n",
+			},
+		},
+		{
+			name:     "template",
+			kind:     NotifierSlack,
+			template: `{{range .Groups}}{{range .Events}}{{.Workspace}} {{.NewVersion}} <{{.Link}}>{{end}}{{end}}`,
+			events:   []*NotificationEvent{event(NotifyAvailable, "network", "1.5.6", "1.6.0"), event(NotifyAvailable, "app", "1.5.6", "1.6.0")},
+			key:      "text",
+			expected: []string{
+				"network 1.6.0 <https://app.terraform.io/app/chroju/workspaces/network/settings/general>",
+				"app 1.6.0 <https://app.terraform.io/app/chroju/workspaces/app/settings/general>",
+			},
+		},
+		{
+			name:     "grouped",
+			kind:     NotifierWebhook,
+			template: `{{range .Groups}}{{.Summary}}: {{len .Events}}{{"\n"}}{{end}}`,
+			events: []*NotificationEvent{
+				event(NotifyUpdated, "a", "1.5.6", "1.6.0"),
+				event(NotifyUpdated, "b", "1.5.5", "1.6.0"),
+				event(NotifyUpdated, "c", "1.5.6", "1.6.0"),
+				failed,
+			},
+			key:      "text",
+			expected: []string{"Updated Terraform 1.5.6 -> 1.6.0: 2\nUpdated Terraform 1.5.5 -> 1.6.0: 1\nFailed to update Terraform 1.5.6 -> 1.6.0: 1\n"},
+		},
+		{
+			name:     "grouped title",
+			kind:     NotifierWebhook,
+			events:   []*NotificationEvent{event(NotifyUpdated, "a", "1.5.6", "1.6.0"), event(NotifyUpdated, "b", "1.5.6", "1.6.0"), event(NotifyUpdated, "c", "1.5.6", "1.6.0"), failed},
+			key:      "title",
+			expected: []string{"terraform-cloud-updater: 4 workspaces (1 failed, 3 updated)"},
+		},
+	}
+
+	for _, v := range cases {
+		sink := &notificationSink{}
+		ts := httptest.NewServer(sink)
+
+		notifier, err := NewNotifier(v.kind, ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := NewNotifications([]Notifier{notifier}, v.template, DefaultNotifyGroupThreshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = n.Send(context.Background(), v.events)
+		ts.Close()
+		if err != nil {
+			t.Errorf("Failed: %s / want no error / got = %s", v.name, err)
+			continue
+		}
+
+		var got []string
+		for _, body := range sink.bodies {
+			s, _ := body[v.key].(string)
+			got = append(got, s)
+		}
+		if strings.Join(got, "|") != strings.Join(v.expected, "|") {
+			t.Errorf("Failed: %s\nwant = %q\ngot = %q", v.name, v.expected, got)
+		}
+	}
+}
+
+func TestNotificationsError(t *testing.T) {
+	failing := &notificationSink{status: http.StatusInternalServerError}
+	tsFailing := httptest.NewServer(failing)
+	defer tsFailing.Close()
+	ok := &notificationSink{}
+	tsOK := httptest.NewServer(ok)
+	defer tsOK.Close()
+
+	var notifiers []Notifier
+	for _, url := range []string{tsFailing.URL, tsOK.URL} {
+		notifier, err := NewNotifier(NotifierWebhook, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	n, err := NewNotifications(notifiers, "", DefaultNotifyGroupThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the failure of a notifier doesn't stop the others
+	err = n.Send(context.Background(), []*NotificationEvent{{Kind: NotifyUpdated, Workspace: "network"}})
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Failed: want = 500 error / got = %v", err)
+	}
+	if len(ok.bodies) != 1 {
+		t.Errorf("Failed: want = 1 notification / got = %d", len(ok.bodies))
+	}
+
+	if _, err := NewNotifier("discord", tsOK.URL, nil); err == nil {
+		t.Errorf("Failed: want error for the unknown notifier / got = nil")
+	}
+	if _, err := NewNotifications(nil, "{{.Title", 0); err == nil {
+		t.Errorf("Failed: want error for the invalid template / got = nil")
+	}
+}
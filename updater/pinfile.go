@@ -0,0 +1,159 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	terraformVersionFile = ".terraform-version"
+	toolVersionsFile     = ".tool-versions"
+	toolVersionsPlugin   = "terraform"
+)
+
+// PinFile represents a file which pins the local Terraform version,
+// tfenv's .terraform-version or asdf's .tool-versions
+type PinFile struct {
+	Path string
+}
+
+// NewPinFile creates a new PinFile. The file does not have to exist.
+func NewPinFile(path string) (*PinFile, error) {
+	switch filepath.Base(path) {
+	case terraformVersionFile, toolVersionsFile:
+		return &PinFile{Path: path}, nil
+	}
+	return nil, fmt.Errorf("%s is neither %s nor %s", path, terraformVersionFile, toolVersionsFile)
+}
+
+// FindPinFile searches the pin file from the given directory up to the root directory, in the same way as tfenv.
+// .terraform-version takes precedence over .tool-versions in the same directory.
+func FindPinFile(dir string) (*PinFile, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(dir, terraformVersionFile)); err == nil {
+			return &PinFile{Path: filepath.Join(dir, terraformVersionFile)}, nil
+		}
+		p := &PinFile{Path: filepath.Join(dir, toolVersionsFile)}
+		if spec, err := p.Read(); err == nil && spec != "" {
+			return p, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, fmt.Errorf("Neither %s nor %s is found", terraformVersionFile, toolVersionsFile)
+		}
+		dir = parent
+	}
+}
+
+// Read returns the pinned version spec, like "0.12.24", "latest" or "latest:^0.12"
+func (p *PinFile) Read() (string, error) {
+	b, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return "", err
+	}
+
+	if filepath.Base(p.Path) == terraformVersionFile {
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		// asdf allows fallback versions after the first one, but only the first one is used here
+		if len(fields) >= 2 && fields[0] == toolVersionsPlugin {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("%s has no %s version", p.Path, toolVersionsPlugin)
+}
+
+// Write pins the given version. Other tools in .tool-versions are kept as they are.
+func (p *PinFile) Write(s *SemanticVersion) error {
+	if filepath.Base(p.Path) == terraformVersionFile {
+		return ioutil.WriteFile(p.Path, []byte(s.String()+"\n"), 0644)
+	}
+
+	b, err := ioutil.ReadFile(p.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	entry := fmt.Sprintf("%s %s", toolVersionsPlugin, s.String())
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		lines = nil
+	}
+	replaced := false
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) >= 1 && fields[0] == toolVersionsPlugin {
+			lines[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		lines = append(lines, entry)
+	}
+	return ioutil.WriteFile(p.Path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// ResolveVersionSpec resolves the version spec of tfenv to the semantic version.
+// "latest" is the greatest stable version, "latest:<regex>" is the greatest version matching the regex,
+// and "min-required" is the oldest stable version compatible with the required versions.
+func (w *Workspace) ResolveVersionSpec(ctx context.Context, spec string) (*SemanticVersion, error) {
+	switch {
+	case spec == "latest":
+		return w.findRelease(ctx, func(s *SemanticVersion) bool { return s.Status == "" })
+	case strings.HasPrefix(spec, "latest:"):
+		re, err := regexp.Compile(strings.TrimPrefix(spec, "latest:"))
+		if err != nil {
+			return nil, fmt.Errorf("%s is not valid version spec: %s", spec, err)
+		}
+		return w.findRelease(ctx, func(s *SemanticVersion) bool { return re.MatchString(s.String()) })
+	case spec == "min-required":
+		releases, err := w.tfRelease.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// the releases are ordered by the release date, and the backports of the older versions come later
+		var oldest *SemanticVersion
+		for _, v := range releases {
+			s := v.SemanticVersion
+			if !v.Draft && s.Status == "" && w.IsCompatibleVersion(s) && (oldest == nil || s.Compare(oldest) < 0) {
+				oldest = s
+			}
+		}
+		if oldest != nil {
+			return oldest, nil
+		}
+		return nil, fmt.Errorf("No version is compatbile with required versions '%s'", w.requiredVersions.String())
+	}
+
+	sv, err := NewSemanticVersion(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not valid version spec", spec)
+	}
+	return sv, nil
+}
+
+func (w *Workspace) findRelease(ctx context.Context, match func(*SemanticVersion) bool) (*SemanticVersion, error) {
+	releases, err := w.tfRelease.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if v := greatestRelease(releases, func(r *TfRelease) bool { return match(r.SemanticVersion) }); v != nil {
+		return v, nil
+	}
+	return nil, fmt.Errorf("No release matches the version spec")
+}
@@ -0,0 +1,172 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPinFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfc-updater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name     string
+		src      string
+		spec     string
+		expected string
+	}{
+		{
+			name:     ".terraform-version",
+			src:      "latest:^0.12\n",
+			spec:     "latest:^0.12",
+			expected: "0.12.25\n",
+		},
+		{
+			name:     ".tool-versions",
+			src:      "golang 1.14.3\nterraform 0.12.20 0.12.19\nnodejs 12.18.0\n",
+			spec:     "0.12.20",
+			expected: "golang 1.14.3\nterraform 0.12.25\nnodejs 12.18.0\n",
+		},
+	}
+
+	for _, v := range cases {
+		path := filepath.Join(dir, v.name)
+		if err := ioutil.WriteFile(path, []byte(v.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := FindPinFile(dir)
+		if err != nil {
+			t.Fatalf("Failed of error: %s / name = %s", err, v.name)
+		}
+		if p.Path != path {
+			t.Errorf("Failed: want = %s / got = %s", path, p.Path)
+		}
+
+		spec, err := p.Read()
+		if err != nil {
+			t.Errorf("Failed of error: %s / name = %s", err, v.name)
+		} else if spec != v.spec {
+			t.Errorf("Failed: name = %s / want = %s / got = %s", v.name, v.spec, spec)
+		}
+
+		if err := p.Write(&SemanticVersion{Versions: []int{0, 12, 25}}); err != nil {
+			t.Fatalf("Failed of error: %s / name = %s", err, v.name)
+		}
+		got, _ := ioutil.ReadFile(path)
+		if string(got) != v.expected {
+			t.Errorf("Failed: name = %s / want = %q / got = %q", v.name, v.expected, string(got))
+		}
+
+		os.Remove(path)
+	}
+}
+
+func TestResolveVersionSpec(t *testing.T) {
+	cases := []struct {
+		spec     string
+		expected *SemanticVersion
+	}{
+		{
+			spec:     "0.12.20",
+			expected: &SemanticVersion{Versions: []int{0, 12, 20}},
+		},
+		{
+			spec:     "latest",
+			expected: &SemanticVersion{Versions: []int{0, 12, 25}},
+		},
+		{
+			spec:     "latest:^0.12.2[34]$",
+			expected: &SemanticVersion{Versions: []int{0, 12, 24}},
+		},
+		{
+			spec:     "min-required",
+			expected: &SemanticVersion{Versions: []int{0, 12, 23}},
+		},
+	}
+
+	w := &Workspace{
+		tfRelease: &TfReleasesMock{},
+		requiredVersions: []*RequiredVersion{
+			{
+				Operator:        ">=",
+				SemanticVersion: &SemanticVersion{Versions: []int{0, 12, 23}},
+			},
+		},
+	}
+	for _, v := range cases {
+		got, err := w.ResolveVersionSpec(context.Background(), v.spec)
+		if err != nil {
+			t.Errorf("Failed of error: %s / spec = %s", err, v.spec)
+		} else if !reflect.DeepEqual(got, v.expected) {
+			t.Errorf("Failed: spec = %s / want = %v / got = %v", v.spec, v.expected, got)
+		}
+	}
+}
+
+func TestResolveVersionSpecBackport(t *testing.T) {
+	// 0.12.30 is a backport released after 0.13.1, and 0.14.0-beta1 is a pre-release
+	list, err := parseTfReleases([]byte(`[{"tag_name": "v0.12.30"}, {"tag_name": "v0.14.0-beta1"}, {"tag_name": "v0.13.1"}, {"tag_name": "v0.13.0"}, {"tag_name": "v0.12.29"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		spec     string
+		expected string
+	}{
+		{spec: "latest", expected: "0.13.1"},
+		{spec: "latest:^0.12", expected: "0.12.30"},
+		{spec: `latest:^0\.1[23]\.`, expected: "0.13.1"},
+		{spec: "latest:^0.14", expected: "0.14.0-beta1"},
+	}
+
+	w := &Workspace{tfRelease: &staticTfReleases{list}}
+	for _, v := range cases {
+		got, err := w.ResolveVersionSpec(context.Background(), v.spec)
+		if err != nil {
+			t.Errorf("Failed of error: %s / spec = %s", err, v.spec)
+		} else if got.String() != v.expected {
+			t.Errorf("Failed: spec = %s / want = %s / got = %s", v.spec, v.expected, got)
+		}
+	}
+}
+
+func TestResolveMinRequiredPaginated(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("per_page") != "100" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("page") == "2" {
+			w.Write([]byte(`[{"tag_name": "v0.12.24"}, {"tag_name": "v0.12.23"}, {"tag_name": "v0.12.22"}]`))
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s/releases?per_page=100&page=2>; rel="next", <http://%s/releases?per_page=100&page=2>; rel="last"`, r.Host, r.Host))
+		w.Write([]byte(`[{"tag_name": "v0.13.0"}, {"tag_name": "v0.12.26"}, {"tag_name": "v0.12.25"}]`))
+	}))
+	defer ts.Close()
+
+	w := &Workspace{
+		tfRelease: &tfReleasesImpl{httpClient: http.DefaultClient, url: ts.URL + "/releases"},
+		requiredVersions: []*RequiredVersion{
+			{Operator: ">=", SemanticVersion: &SemanticVersion{Versions: []int{0, 12, 23}}},
+		},
+	}
+	got, err := w.ResolveVersionSpec(context.Background(), "min-required")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "0.12.23" {
+		t.Errorf("Failed: want = 0.12.23 / got = %s", got)
+	}
+}
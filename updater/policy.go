@@ -0,0 +1,210 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+)
+
+// Policy is the local policy of Terraform versions, which is defined in .tfc-updater.hcl
+type Policy struct {
+	Projects     []*ScopePolicy
+	VariableSets []*ScopePolicy
+	Rules        []*Rule
+	Exceptions   []*Exception
+	Windows      []*MaintenanceWindow
+	Freezes      []*Freeze
+}
+
+// ScopePolicy is the policy for the workspaces in a project, or the ones with a variable set
+type ScopePolicy struct {
+	// Kind is "project" or "variable_set"
+	Kind           string
+	Name           string
+	DefaultVersion *WorkspaceVersion
+	// Source is where the policy is declared, like ".tfc-updater.hcl:3". It is empty if unknown.
+	Source string
+}
+
+func (p *ScopePolicy) String() string {
+	return fmt.Sprintf("%s %q", p.Kind, p.Name)
+}
+
+// PolicyViolation is the error for the workspace whose version is not the default version of the policy
+type PolicyViolation struct {
+	Workspace string
+	Actual    *WorkspaceVersion
+	Policy    *ScopePolicy
+}
+
+func (e *PolicyViolation) Error() string {
+	source := ""
+	if e.Policy.Source != "" {
+		source = fmt.Sprintf(" (%s)", e.Policy.Source)
+	}
+	return fmt.Sprintf("Workspace %s has version %s, but the default version of %s is %s%s", e.Workspace, e.Actual, e.Policy, e.Policy.DefaultVersion, source)
+}
+
+// FindDefaultVersion returns the policy which defines the default version for the scope, or nil if there is no such policy.
+// Variable sets take precedence over the project, because they are attached to the selected workspaces.
+func (p *Policy) FindDefaultVersion(scope *WorkspaceScope) *ScopePolicy {
+	for _, vp := range p.VariableSets {
+		for _, name := range scope.VariableSets {
+			if vp.Name == name && vp.DefaultVersion != nil {
+				return vp
+			}
+		}
+	}
+	for _, pp := range p.Projects {
+		if pp.Name == scope.Project && pp.DefaultVersion != nil {
+			return pp
+		}
+	}
+	return nil
+}
+
+// CheckPolicy checks the workspace has the default version of the policy.
+// It returns *PolicyViolation if the workspace has another version.
+func (w *Workspace) CheckPolicy(ctx context.Context, p *Policy) error {
+	if p == nil || (len(p.Projects) == 0 && len(p.VariableSets) == 0) {
+		return nil
+	}
+
+	scope, err := w.GetScope(ctx)
+	if err != nil {
+		return err
+	}
+	sp := p.FindDefaultVersion(scope)
+	if sp == nil {
+		return nil
+	}
+
+	current, err := w.GetWorkspaceVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if !current.Equal(sp.DefaultVersion) {
+		return &PolicyViolation{Workspace: w.workspace, Actual: current, Policy: sp}
+	}
+	return nil
+}
+
+// Update strategies of the rule, which limit how far a workspace is updated at once
+const (
+	UpdatePatch = "patch"
+	UpdateMinor = "minor"
+	UpdateMajor = "major"
+)
+
+// Rule declares the desired version of the workspaces which match it.
+// Either Version or Update is set.
+type Rule struct {
+	Name string
+	// Workspaces are glob patterns of the workspace names, like "sandbox-*"
+	Workspaces []string
+	// Tags must all be attached to the workspace
+	Tags []string
+	// Version is set to the workspace as it is, like "latest" or "~> 1.5.0"
+	Version *WorkspaceVersion
+	// Update is the update strategy, "patch", "minor" or "major"
+	Update string
+	// Cooldown is how long a release must have been published before it is used by Update
+	Cooldown time.Duration
+	// Source is where the rule is declared, like ".tfc-updater.hcl:3". It is empty if unknown.
+	Source string
+}
+
+func (r *Rule) String() string {
+	return fmt.Sprintf("rule %q", r.Name)
+}
+
+// Match returns true if the workspace matches the rule.
+// A rule without workspaces and tags matches every workspace.
+func (r *Rule) Match(workspace string, scope *WorkspaceScope) bool {
+	return matchWorkspace(r.Workspaces, r.Tags, workspace, scope)
+}
+
+// matchWorkspace returns true if the workspace name matches any of the patterns, and the workspace has all the tags.
+// Empty patterns or tags match every workspace.
+func matchWorkspace(patterns, tags []string, workspace string, scope *WorkspaceScope) bool {
+	if len(patterns) > 0 {
+		matched := false
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, workspace); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, tag := range tags {
+		if !containsString(scope.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Exception pins the workspace to the version until it expires, regardless of the rules
+type Exception struct {
+	Workspace string
+	Version   *WorkspaceVersion
+	// Expires is the last day the exception applies
+	Expires time.Time
+	Reason  string
+	// Source is where the exception is declared, like ".tfc-updater.hcl:3". It is empty if unknown.
+	Source string
+}
+
+func (e *Exception) String() string {
+	return fmt.Sprintf("exception %q", e.Workspace)
+}
+
+// IsExpired returns true if the exception doesn't apply at now
+func (e *Exception) IsExpired(now time.Time) bool {
+	return !now.Before(e.Expires.AddDate(0, 0, 1))
+}
+
+// FindRule returns the first rule which the workspace matches, or nil if there is no such rule
+func (p *Policy) FindRule(workspace string, scope *WorkspaceScope) *Rule {
+	for _, r := range p.Rules {
+		if r.Match(workspace, scope) {
+			return r
+		}
+	}
+	return nil
+}
+
+// FindException returns the exception for the workspace which is not expired at now, or nil if there is no such exception
+func (p *Policy) FindException(workspace string, now time.Time) *Exception {
+	for _, e := range p.Exceptions {
+		if e.Workspace == workspace && !e.IsExpired(now) {
+			return e
+		}
+	}
+	return nil
+}
+
+// ExpiredExceptions returns the exceptions which are expired at now, so that they can be removed from the policy file
+func (p *Policy) ExpiredExceptions(now time.Time) []*Exception {
+	var expired []*Exception
+	for _, e := range p.Exceptions {
+		if e.IsExpired(now) {
+			expired = append(expired, e)
+		}
+	}
+	return expired
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
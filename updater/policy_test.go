@@ -0,0 +1,144 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newPolicyForTest(t *testing.T) *Policy {
+	project, err := NewWorkspaceVersion("0.12.24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	varset, err := NewWorkspaceVersion("~> 0.12.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Policy{
+		Projects:     []*ScopePolicy{{Kind: "project", Name: "infra", DefaultVersion: project, Source: ".tfc-updater.hcl:1"}},
+		VariableSets: []*ScopePolicy{{Kind: "variable_set", Name: "tracking", DefaultVersion: varset, Source: ".tfc-updater.hcl:5"}},
+	}
+}
+
+func TestAudit(t *testing.T) {
+	cases := []struct {
+		version          *SemanticVersion
+		workspaceVersion string
+		scope            *WorkspaceScope
+		expected         string
+	}{
+		{
+			version:  &SemanticVersion{Versions: []int{0, 12, 25}},
+			scope:    &WorkspaceScope{Project: "other"},
+			expected: AuditOK,
+		},
+		{
+			version:  &SemanticVersion{Versions: []int{0, 12, 20}},
+			scope:    &WorkspaceScope{Project: "other"},
+			expected: AuditOutdated,
+		},
+		{
+			version:  &SemanticVersion{Versions: []int{0, 12, 24}},
+			scope:    &WorkspaceScope{Project: "infra"},
+			expected: AuditOutdated,
+		},
+		{
+			version:  &SemanticVersion{Versions: []int{0, 12, 25}},
+			scope:    &WorkspaceScope{Project: "infra"},
+			expected: AuditPolicyViolation,
+		},
+		{
+			// variable set takes precedence over the project
+			workspaceVersion: "~> 0.12.0",
+			scope:            &WorkspaceScope{Project: "infra", VariableSets: []string{"tracking"}},
+			expected:         AuditOK,
+		},
+		{
+			version:  &SemanticVersion{Versions: []int{0, 12, 24}},
+			scope:    &WorkspaceScope{Project: "infra", VariableSets: []string{"tracking"}},
+			expected: AuditPolicyViolation,
+		},
+	}
+
+	policy := newPolicyForTest(t)
+	for _, v := range cases {
+		client := &TfCloudMock{version: v.version, scope: v.scope}
+		if v.workspaceVersion != "" {
+			client.workspaceVersion, _ = NewWorkspaceVersion(v.workspaceVersion)
+		}
+		w := &Workspace{client: client, tfRelease: &TfReleasesMock{}, organization: "chroju", workspace: "sample"}
+
+		result := w.Audit(context.Background(), policy)
+		if result.Status != v.expected {
+			t.Errorf("Failed: version = %v%s / scope = %+v / want = %s / got = %+v", v.version, v.workspaceVersion, v.scope, v.expected, result)
+		}
+	}
+}
+
+func TestListWorkspaces(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/organizations/chroju/projects":
+			fmt.Fprint(w, `{"data": [{"id": "prj-other", "type": "projects", "attributes": {"name": "infra-old"}}, {"id": "prj-infra", "type": "projects", "attributes": {"name": "infra"}}]}`)
+		case "/api/v2/organizations/chroju/workspaces":
+			switch r.URL.Query().Get("filter[project][id]") {
+			case "":
+				fmt.Fprint(w, `{"data": [{"id": "ws-1", "type": "workspaces", "attributes": {"name": "network"}}, {"id": "ws-3", "type": "workspaces", "attributes": {"name": "sandbox"}}]}`)
+				return
+			case "prj-infra":
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if r.URL.Query().Get("page[number]") == "1" {
+				fmt.Fprint(w, `{"data": [{"id": "ws-1", "type": "workspaces", "attributes": {"name": "network"}}], "meta": {"pagination": {"next-page": 2}}}`)
+			} else {
+				fmt.Fprint(w, `{"data": [{"id": "ws-2", "type": "workspaces", "attributes": {"name": "database"}}], "meta": {"pagination": {"next-page": null}}}`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client := &tfcloudImpl{address: ts.URL, httpClient: http.DefaultClient}
+	cases := []struct {
+		project  string
+		expected []string
+		err      bool
+	}{
+		{project: "infra", expected: []string{"network", "database"}},
+		{project: "prj-infra", expected: []string{"network", "database"}},
+		{project: "unknown", err: true},
+		{project: "", expected: []string{"network", "sandbox"}},
+	}
+
+	for _, v := range cases {
+		got, err := client.ListWorkspaces(context.Background(), "chroju", v.project)
+		if (err != nil) != v.err {
+			t.Errorf("Failed: project = %s / want error = %t / got = %v", v.project, v.err, err)
+		} else if !reflect.DeepEqual(got, v.expected) && !v.err {
+			t.Errorf("Failed: project = %s / want = %v / got = %v", v.project, v.expected, got)
+		}
+	}
+}
+
+func TestForWorkspace(t *testing.T) {
+	w := &Workspace{
+		organization:     "chroju",
+		workspace:        "network",
+		requiredVersions: RequiredVersions{{Operator: "~>", SemanticVersion: &SemanticVersion{Versions: []int{0, 12, 0}}}},
+	}
+
+	// the required versions of the root path are not applied to the other workspaces
+	if got := w.ForWorkspace("database"); got.GetName() != "database" || len(got.requiredVersions) != 0 {
+		t.Errorf("Failed: want = database without required versions / got = %s, %v", got.GetName(), got.requiredVersions)
+	}
+	if got := w.ForWorkspace("network"); len(got.requiredVersions) != 1 {
+		t.Errorf("Failed: want = network with ~> 0.12.0 / got = %v", got.requiredVersions)
+	}
+}
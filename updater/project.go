@@ -0,0 +1,120 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WorkspaceScope is where the workspace belongs to, which the policy is defined for
+type WorkspaceScope struct {
+	Project      string
+	VariableSets []string
+	Tags         []string
+}
+
+// ListWorkspaces lists up the workspace names in the project, or in the organization if the project is empty.
+// The project can be given by its name or ID like "prj-XXXX".
+// Projects are read through the API directly, because go-tfe doesn't support them.
+func (t *tfcloudImpl) ListWorkspaces(ctx context.Context, org, project string) ([]string, error) {
+	query := url.Values{}
+	projectID := project
+	if project != "" && !strings.HasPrefix(project, "prj-") {
+		projects, err := t.apiList(ctx, fmt.Sprintf("organizations/%s/projects", url.PathEscape(org)), url.Values{"filter[names]": {project}})
+		if err != nil {
+			return nil, err
+		}
+		projectID = ""
+		for _, p := range projects {
+			if p.stringAttribute("name") == project {
+				projectID = p.ID
+				break
+			}
+		}
+		if projectID == "" {
+			return nil, fmt.Errorf("Project %s is not found in organization %s", project, org)
+		}
+	}
+
+	if projectID != "" {
+		query.Set("filter[project][id]", projectID)
+	}
+	return t.listWorkspaceNames(ctx, org, query)
+}
+
+// ListTaggedWorkspaces lists up the workspace names with the tag in the organization
+func (t *tfcloudImpl) ListTaggedWorkspaces(ctx context.Context, org, tag string) ([]string, error) {
+	return t.listWorkspaceNames(ctx, org, url.Values{"search[tags]": {tag}})
+}
+
+func (t *tfcloudImpl) listWorkspaceNames(ctx context.Context, org string, query url.Values) ([]string, error) {
+	workspaces, err := t.apiList(ctx, fmt.Sprintf("organizations/%s/workspaces", url.PathEscape(org)), query)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(workspaces))
+	for i, ws := range workspaces {
+		names[i] = ws.stringAttribute("name")
+	}
+	return names, nil
+}
+
+// ReadWorkspaceScope reads the project, the variable sets and the tags of the workspace
+func (t *tfcloudImpl) ReadWorkspaceScope(ctx context.Context, org, workspace string) (*WorkspaceScope, error) {
+	var ws apiDocument
+	if err := t.apiRequest(ctx, http.MethodGet, fmt.Sprintf("organizations/%s/workspaces/%s", url.PathEscape(org), url.PathEscape(workspace)), nil, &ws); err != nil {
+		return nil, err
+	}
+
+	scope := &WorkspaceScope{Tags: ws.Data.stringsAttribute("tag-names")}
+	if rel, ok := ws.Data.Relationships["project"]; ok && rel.Data != nil {
+		var project apiDocument
+		if err := t.apiRequest(ctx, http.MethodGet, "projects/"+rel.Data.ID, nil, &project); err != nil {
+			return nil, err
+		}
+		scope.Project = project.Data.stringAttribute("name")
+	}
+
+	varsets, err := t.apiList(ctx, fmt.Sprintf("workspaces/%s/varsets", ws.Data.ID), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range varsets {
+		scope.VariableSets = append(scope.VariableSets, v.stringAttribute("name"))
+	}
+	return scope, nil
+}
+
+// GetScope returns the project, the variable sets and the tags of the workspace
+func (w *Workspace) GetScope(ctx context.Context) (*WorkspaceScope, error) {
+	return w.client.ReadWorkspaceScope(ctx, w.organization, w.workspace)
+}
+
+// ForWorkspace returns the workspace with the given name in the same organization.
+// It shares the settings like the journal with w, but not the required versions,
+// which are declared in the configuration of w and unknown for the other workspaces.
+func (w *Workspace) ForWorkspace(name string) *Workspace {
+	other := *w
+	other.workspace = name
+	if name != w.workspace {
+		other.requiredVersions = nil
+	}
+	return &other
+}
+
+// ListWorkspaces returns the workspaces in the project, or in the organization if the project is empty.
+// They share the settings with w, except the required versions.
+func (w *Workspace) ListWorkspaces(ctx context.Context, project string) ([]*Workspace, error) {
+	names, err := w.client.ListWorkspaces(ctx, w.organization, project)
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces := make([]*Workspace, len(names))
+	for i, name := range names {
+		workspaces[i] = w.ForWorkspace(name)
+	}
+	return workspaces, nil
+}
@@ -0,0 +1,173 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Reconcile statuses of the workspace
+const (
+	ReconcileInSync      = "in_sync"
+	ReconcileChanged     = "changed"
+	ReconcileWouldChange = "would_change"
+	ReconcileNoRule      = "no_rule"
+	ReconcileError       = "error"
+)
+
+// ReconcileResult is the result of reconciling the workspace with the policy
+type ReconcileResult struct {
+	Organization   string `json:"organization"`
+	Workspace      string `json:"workspace"`
+	Version        string `json:"version"`
+	DesiredVersion string `json:"desired_version,omitempty"`
+	// Policy is the rule, the exception or the scope which decides the desired version, like `rule "prod"`
+	Policy string `json:"policy,omitempty"`
+	Source string `json:"source,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	err    error
+}
+
+// Err returns the error which stopped reconciling the workspace, or nil
+func (r *ReconcileResult) Err() error {
+	return r.err
+}
+
+// Reconcile sets the workspace to the desired version of the policy at now.
+// The desired version is decided by the exception of the workspace, the first matching rule, or the default version of the scope in this order.
+// Errors are not returned but recorded in the result, so that one workspace doesn't stop reconciling others.
+func (w *Workspace) Reconcile(ctx context.Context, p *Policy, now time.Time) *ReconcileResult {
+	result := &ReconcileResult{Organization: w.organization, Workspace: w.workspace}
+	fail := func(err error) *ReconcileResult {
+		result.Status = ReconcileError
+		result.Error = err.Error()
+		result.err = err
+		return result
+	}
+
+	// the version of the workspace may be unknown, which can be still overwritten by the policy
+	current, err := w.GetWorkspaceVersion(ctx)
+	var parseErr *VersionParseError
+	if errors.As(err, &parseErr) {
+		result.Version = parseErr.Raw
+		current = nil
+	} else if err != nil {
+		return fail(err)
+	} else {
+		result.Version = current.String()
+	}
+
+	desired, policy, source, err := w.desiredVersion(ctx, p, current, now)
+	if err != nil {
+		return fail(err)
+	}
+	if desired == nil {
+		result.Status = ReconcileNoRule
+		return result
+	}
+	result.DesiredVersion = desired.String()
+	result.Policy = policy
+	result.Source = source
+
+	if current != nil && current.Equal(desired) {
+		result.Status = ReconcileInSync
+		return result
+	}
+
+	if err := w.SetWorkspaceVersion(ctx, desired); err != nil {
+		return fail(err)
+	}
+	result.Status = ReconcileChanged
+	if w.dryRun {
+		result.Status = ReconcileWouldChange
+	}
+	return result
+}
+
+// desiredVersion returns the desired version of the workspace, and the policy which decides it with its source.
+// It returns nil if no policy applies to the workspace.
+func (w *Workspace) desiredVersion(ctx context.Context, p *Policy, current *WorkspaceVersion, now time.Time) (*WorkspaceVersion, string, string, error) {
+	if p == nil {
+		return nil, "", "", nil
+	}
+
+	if e := p.FindException(w.workspace, now); e != nil {
+		return e.Version, e.String(), e.Source, nil
+	}
+
+	scope, err := w.GetScope(ctx)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if r := p.FindRule(w.workspace, scope); r != nil {
+		if r.Version != nil {
+			return r.Version, r.String(), r.Source, nil
+		}
+		if current == nil {
+			return nil, "", "", fmt.Errorf("The version of workspace %s is unknown, so %s can't update it", w.workspace, r)
+		}
+		v, err := w.nextVersion(ctx, r, current, now)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return v, r.String(), r.Source, nil
+	}
+
+	if sp := p.FindDefaultVersion(scope); sp != nil {
+		return sp.DefaultVersion, sp.String(), sp.Source, nil
+	}
+	return nil, "", "", nil
+}
+
+// nextVersion returns the newest stable release which the update strategy of the rule allows from the current version.
+// A release is used only after the cooldown of the rule has passed since it was published.
+// The workspace is never downgraded, and it is pinned to the version.
+func (w *Workspace) nextVersion(ctx context.Context, r *Rule, current *WorkspaceVersion, now time.Time) (*WorkspaceVersion, error) {
+	resolved, err := w.ResolveWorkspaceVersion(ctx, current)
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err := w.tfRelease.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	next := greatestRelease(releases, func(v *TfRelease) bool {
+		s := v.SemanticVersion
+		if !isStableRelease(v) || s.Compare(resolved) <= 0 {
+			return false
+		}
+		if !isAllowedUpdate(r.Update, resolved, s) || !w.requiredVersions.CheckVersionConsistency(s) {
+			return false
+		}
+		return r.Cooldown <= 0 || (!v.PublishedAt.IsZero() && now.Sub(v.PublishedAt) >= r.Cooldown)
+	})
+	if next == nil {
+		next = resolved
+	}
+	return PinnedWorkspaceVersion(next), nil
+}
+
+// isAllowedUpdate returns true if the update strategy allows updating from the version to the target
+func isAllowedUpdate(strategy string, from, to *SemanticVersion) bool {
+	switch strategy {
+	case UpdatePatch:
+		return versionPart(from, 0) == versionPart(to, 0) && versionPart(from, 1) == versionPart(to, 1)
+	case UpdateMinor:
+		return versionPart(from, 0) == versionPart(to, 0)
+	case UpdateMajor:
+		return true
+	}
+	return false
+}
+
+func versionPart(s *SemanticVersion, i int) int {
+	if i < len(s.Versions) {
+		return s.Versions[i]
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package updater
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	release := func(v string, age time.Duration) *TfRelease {
+		s, _ := NewSemanticVersion(v)
+		return &TfRelease{Tag: "v" + v, PublishedAt: now.Add(-age), SemanticVersion: s}
+	}
+	day := 24 * time.Hour
+	releases := []*TfRelease{
+		release("2.0.0-beta1", day),
+		release("1.6.0", day),
+		release("1.5.7", 3*day),
+		release("1.5.6", 30*day),
+		release("1.5.5", 60*day),
+	}
+
+	version := func(s string) *WorkspaceVersion {
+		v, err := NewWorkspaceVersion(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	policy := &Policy{
+		Projects: []*ScopePolicy{{Kind: "project", Name: "infra", DefaultVersion: version("1.5.6")}},
+		Rules: []*Rule{
+			{Name: "sandbox", Workspaces: []string{"sandbox-*"}, Version: version("latest")},
+			{Name: "prod", Tags: []string{"prod"}, Update: UpdatePatch, Cooldown: 14 * day},
+			{Name: "staging", Tags: []string{"staging"}, Update: UpdateMinor},
+			{Name: "dev", Tags: []string{"dev"}, Update: UpdatePatch},
+		},
+		Exceptions: []*Exception{
+			{Workspace: "legacy", Version: version("1.5.5"), Expires: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+			{Workspace: "expired", Version: version("1.5.5"), Expires: time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	cases := []struct {
+		workspace string
+		version   string
+		scope     *WorkspaceScope
+		dryRun    bool
+		status    string
+		desired   string
+		policy    string
+	}{
+		{workspace: "network", version: "1.5.5", scope: &WorkspaceScope{Tags: []string{"prod"}}, status: ReconcileChanged, desired: "1.5.6", policy: `rule "prod"`},
+		{workspace: "network", version: "1.5.6", scope: &WorkspaceScope{Tags: []string{"prod"}}, status: ReconcileInSync, desired: "1.5.6", policy: `rule "prod"`},
+		{workspace: "network", version: "1.5.5", scope: &WorkspaceScope{Tags: []string{"dev"}}, status: ReconcileChanged, desired: "1.5.7", policy: `rule "dev"`},
+		{workspace: "network", version: "1.5.5", scope: &WorkspaceScope{Tags: []string{"staging"}}, status: ReconcileChanged, desired: "1.6.0", policy: `rule "staging"`},
+		// "latest" is pinned to the version it resolves to
+		{workspace: "network", version: "latest", scope: &WorkspaceScope{Tags: []string{"dev"}}, status: ReconcileChanged, desired: "1.6.0", policy: `rule "dev"`},
+		{workspace: "sandbox-1", version: "1.5.5", scope: &WorkspaceScope{Tags: []string{"prod"}}, status: ReconcileChanged, desired: "latest", policy: `rule "sandbox"`},
+		{workspace: "sandbox-1", version: "1.5.5", dryRun: true, status: ReconcileWouldChange, desired: "latest", policy: `rule "sandbox"`},
+		{workspace: "legacy", version: "1.5.5", scope: &WorkspaceScope{Tags: []string{"prod"}}, status: ReconcileInSync, desired: "1.5.5", policy: `exception "legacy"`},
+		{workspace: "expired", version: "1.5.5", scope: &WorkspaceScope{Tags: []string{"prod"}}, status: ReconcileChanged, desired: "1.5.6", policy: `rule "prod"`},
+		{workspace: "network", version: "1.5.5", scope: &WorkspaceScope{Project: "infra"}, status: ReconcileChanged, desired: "1.5.6", policy: `project "infra"`},
+		{workspace: "network", version: "1.5.5", scope: &WorkspaceScope{Project: "other"}, status: ReconcileNoRule},
+	}
+
+	for _, v := range cases {
+		client := &TfCloudMock{workspaceVersion: version(v.version), scope: v.scope}
+		w := &Workspace{client: client, tfRelease: &tfReleasesImpl{releases: releases}, organization: "chroju", workspace: v.workspace, dryRun: v.dryRun}
+
+		result := w.Reconcile(context.Background(), policy, now)
+		if result.Status != v.status || result.DesiredVersion != v.desired || result.Policy != v.policy {
+			t.Errorf("Failed: workspace = %s, %s / want = %s, %s, %s / got = %+v", v.workspace, v.version, v.status, v.desired, v.policy, result)
+			continue
+		}
+
+		got, _ := w.GetWorkspaceVersion(context.Background())
+		expected := v.version
+		if v.status == ReconcileChanged {
+			expected = v.desired
+		}
+		if got.String() != expected {
+			t.Errorf("Failed: workspace = %s, %s / want version = %s / got = %s", v.workspace, v.version, expected, got)
+		}
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	cases := []struct {
+		rule      *Rule
+		workspace string
+		tags      []string
+		expected  bool
+	}{
+		{rule: &Rule{}, workspace: "network", expected: true},
+		{rule: &Rule{Workspaces: []string{"sandbox-*"}}, workspace: "sandbox-1", expected: true},
+		{rule: &Rule{Workspaces: []string{"sandbox-*"}}, workspace: "network", expected: false},
+		{rule: &Rule{Workspaces: []string{"sandbox-*", "network"}}, workspace: "network", expected: true},
+		{rule: &Rule{Tags: []string{"prod", "aws"}}, workspace: "network", tags: []string{"aws", "prod"}, expected: true},
+		{rule: &Rule{Tags: []string{"prod", "aws"}}, workspace: "network", tags: []string{"prod"}, expected: false},
+		{rule: &Rule{Workspaces: []string{"sandbox-*"}, Tags: []string{"prod"}}, workspace: "network", tags: []string{"prod"}, expected: false},
+	}
+
+	for _, v := range cases {
+		got := v.rule.Match(v.workspace, &WorkspaceScope{Tags: v.tags})
+		if got != v.expected {
+			t.Errorf("Failed: rule = %+v / workspace = %s, %v / want = %t / got = %t", v.rule, v.workspace, v.tags, v.expected, got)
+		}
+	}
+}
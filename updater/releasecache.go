@@ -0,0 +1,85 @@
+package updater
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultReleaseCacheTTL is the default time to use the cached releases without revalidation
+const DefaultReleaseCacheTTL = time.Hour
+
+// ReleaseCache is the Terraform release list cached in the local file
+type ReleaseCache struct {
+	path string
+	ttl  time.Duration
+}
+
+// releaseCacheEntry is the content of the cache file, which keeps the releases of all the pages
+type releaseCacheEntry struct {
+	URL       string          `json:"url"`
+	ETag      string          `json:"etag"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	Body      json.RawMessage `json:"body"`
+}
+
+// NewReleaseCache creates a new ReleaseCache
+func NewReleaseCache(path string, ttl time.Duration) *ReleaseCache {
+	return &ReleaseCache{path: path, ttl: ttl}
+}
+
+// DefaultReleaseCachePath returns the cache path under $XDG_CACHE_HOME
+func DefaultReleaseCachePath() string {
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome == "" {
+		cacheHome = filepath.Join(os.Getenv("HOME"), ".cache")
+	}
+	return filepath.Join(cacheHome, "terraform-cloud-updater", "releases.json")
+}
+
+// load returns the cached entry of the url, or nil if there is no entry.
+// A broken cache file is treated as no entry, since it is fetched again anyway.
+func (c *ReleaseCache) load(url string) *releaseCacheEntry {
+	b, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return nil
+	}
+
+	var entry releaseCacheEntry
+	if err = json.Unmarshal(b, &entry); err != nil || entry.URL != url || len(entry.Body) == 0 {
+		return nil
+	}
+	return &entry
+}
+
+func (c *ReleaseCache) save(entry *releaseCacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+
+	// write and rename, so that concurrent runs never read a partial file
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), ".releases-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+func (e *releaseCacheEntry) isFresh(ttl time.Duration, now time.Time) bool {
+	return now.Sub(e.FetchedAt) < ttl
+}
@@ -0,0 +1,315 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTfReleasesCache(t *testing.T) {
+	const etag = `"v1"`
+	var requests, notModified int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(`[{"draft": false, "tag_name": "v0.13.0"}, {"draft": false, "tag_name": "v0.12.29"}]`))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "releasecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "releases.json")
+
+	cases := []struct {
+		ttl             time.Duration
+		cache           bool
+		wantRequests    int
+		wantNotModified int
+	}{
+		// first run fetches and saves the releases
+		{ttl: time.Hour, cache: true, wantRequests: 1, wantNotModified: 0},
+		// fresh cache is used without any request
+		{ttl: time.Hour, cache: true, wantRequests: 1, wantNotModified: 0},
+		// stale cache is revalidated with the ETag
+		{ttl: 0, cache: true, wantRequests: 2, wantNotModified: 1},
+		// no cache always fetches
+		{ttl: time.Hour, cache: false, wantRequests: 3, wantNotModified: 1},
+	}
+
+	for i, v := range cases {
+		var cache *ReleaseCache
+		if v.cache {
+			cache = NewReleaseCache(path, v.ttl)
+		}
+		releases := &tfReleasesImpl{httpClient: http.DefaultClient, url: ts.URL, cache: cache}
+
+		// the second call is served from memory
+		for j := 0; j < 2; j++ {
+			got, err := releases.List(context.Background())
+			if err != nil {
+				t.Fatalf("Failed of error: %s / case = %d", err, i)
+			}
+			if len(got) != 2 || got[0].SemanticVersion.String() != "0.13.0" {
+				t.Errorf("Failed: case = %d / want = [0.13.0 0.12.29] / got = %v", i, got)
+			}
+		}
+		if requests != v.wantRequests || notModified != v.wantNotModified {
+			t.Errorf("Failed: case = %d / want requests = %d, not modified = %d / got = %d, %d", i, v.wantRequests, v.wantNotModified, requests, notModified)
+		}
+	}
+}
+
+func TestTfReleasesCachePaginated(t *testing.T) {
+	etag := `"v1"`
+	firstPage := `[{"tag_name": "v0.13.0"}, {"tag_name": "v0.12.29"}]`
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			page = "1"
+		}
+		requests = append(requests, page)
+		if page == "2" {
+			w.Write([]byte(`[{"tag_name": "v0.12.28"}, {"tag_name": "v0.12.27"}]`))
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s/?per_page=100&page=2>; rel="next"`, r.Host))
+		w.Write([]byte(firstPage))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "releasecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "releases.json")
+
+	cases := []struct {
+		etag         string
+		firstPage    string
+		wantRequests string
+		wantVersions string
+	}{
+		// first run fetches and saves all the pages
+		{etag: `"v1"`, firstPage: firstPage, wantRequests: "1 2", wantVersions: "0.13.0 0.12.29 0.12.28 0.12.27"},
+		// the first page is revalidated, and the cached pages are used as they are
+		{etag: `"v1"`, firstPage: firstPage, wantRequests: "1", wantVersions: "0.13.0 0.12.29 0.12.28 0.12.27"},
+		// a new release changes the first page, so all the pages are fetched again
+		{etag: `"v2"`, firstPage: `[{"tag_name": "v0.13.1"}, {"tag_name": "v0.13.0"}, {"tag_name": "v0.12.29"}]`, wantRequests: "1 2", wantVersions: "0.13.1 0.13.0 0.12.29 0.12.28 0.12.27"},
+		// the cache is revalidated with the ETag of the new first page
+		{etag: `"v2"`, firstPage: firstPage, wantRequests: "1", wantVersions: "0.13.1 0.13.0 0.12.29 0.12.28 0.12.27"},
+	}
+
+	for i, v := range cases {
+		etag, firstPage, requests = v.etag, v.firstPage, nil
+		releases := &tfReleasesImpl{httpClient: http.DefaultClient, url: ts.URL, cache: NewReleaseCache(path, 0)}
+		list, err := releases.List(context.Background())
+		if err != nil {
+			t.Fatalf("Failed of error: %s / case = %d", err, i)
+		}
+		got := make([]string, len(list))
+		for j, r := range list {
+			got[j] = r.SemanticVersion.String()
+		}
+		if strings.Join(got, " ") != v.wantVersions {
+			t.Errorf("Failed: case = %d / want = %s / got = %s", i, v.wantVersions, strings.Join(got, " "))
+		}
+		if strings.Join(requests, " ") != v.wantRequests {
+			t.Errorf("Failed: case = %d / want requested pages = %s / got = %s", i, v.wantRequests, strings.Join(requests, " "))
+		}
+	}
+}
+
+func TestReleaseCacheBroken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "releasecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "releases.json")
+
+	if err = ioutil.WriteFile(path, []byte("{broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if entry := NewReleaseCache(path, time.Hour).load("https://example.com"); entry != nil {
+		t.Errorf("Failed: want = nil / got = %v", entry)
+	}
+}
+
+func TestFileTfReleases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "releasesfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "releases.json")
+
+	exported, err := parseTfReleases([]byte(`[{"draft": false, "tag_name": "v0.13.0", "name": "v0.13.0"}, {"draft": true, "tag_name": "v0.14.0-alpha1"}]`))
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteTfReleases(file, exported); err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	file.Close()
+
+	got, err := NewFileTfReleases(path).List(context.Background())
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if len(got) != 2 || got[0].SemanticVersion.String() != "0.13.0" || !got[1].Draft {
+		t.Errorf("Failed: want = [0.13.0 0.14.0-alpha1(draft)] / got = %v", got)
+	}
+}
+
+func TestCachedTfReleases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "releasecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := NewReleaseCache(filepath.Join(dir, "releases.json"), time.Hour)
+
+	if _, err = NewCachedTfReleases(cache).List(context.Background()); err == nil {
+		t.Errorf("Failed: want = error for no cache / got = nil")
+	}
+
+	// expired cache is still used in offline
+	err = cache.save(&releaseCacheEntry{
+		URL:       tfReleaseURL,
+		FetchedAt: time.Now().Add(-24 * time.Hour),
+		Body:      []byte(`[{"draft": false, "tag_name": "v0.12.29"}]`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewCachedTfReleases(cache).List(context.Background())
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if len(got) != 1 || got[0].SemanticVersion.String() != "0.12.29" {
+		t.Errorf("Failed: want = [0.12.29] / got = %v", got)
+	}
+}
+
+func TestExportPaginatedReleases(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 2 {
+			page = 1
+		}
+		if page < 3 {
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s/releases?per_page=100&page=%d>; rel="next"`, r.Host, page+1))
+		}
+		var items []string
+		for i := 0; i < 100; i++ {
+			items = append(items, fmt.Sprintf(`{"draft": false, "tag_name": "v%d.%d.0"}`, 4-page, 99-i))
+		}
+		w.Write([]byte("[" + strings.Join(items, ",") + "]"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "releasesfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "releases.json")
+
+	releases, err := (&tfReleasesImpl{httpClient: http.DefaultClient, url: ts.URL + "/releases"}).List(context.Background())
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteTfReleases(file, releases); err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	file.Close()
+
+	got, err := NewFileTfReleases(path).List(context.Background())
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if len(got) != 300 || got[0].SemanticVersion.String() != "3.99.0" || got[299].SemanticVersion.String() != "1.0.0" {
+		t.Errorf("Failed: want = 300 releases from 3.99.0 to 1.0.0 / got = %d", len(got))
+	}
+}
+
+func TestAnnouncedTfReleases(t *testing.T) {
+	source, err := parseTfReleases([]byte(`[{"tag_name": "v1.6.0"}, {"tag_name": "v1.5.6"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	announced := func(versions ...string) []*TfRelease {
+		var releases []*TfRelease
+		for _, v := range versions {
+			sv, _ := NewSemanticVersion(v)
+			releases = append(releases, &TfRelease{Tag: "v" + v, SemanticVersion: sv})
+		}
+		return releases
+	}
+
+	cases := []struct {
+		announced []*TfRelease
+		expected  string
+	}{
+		{announced: announced("1.6.1"), expected: "1.6.1,1.6.0,1.5.6"},
+		{announced: announced("1.5.7"), expected: "1.6.0,1.5.7,1.5.6"},
+		{announced: announced("1.6.0"), expected: "1.6.0,1.5.6"},
+		{announced: announced("1.6.1", "1.4.0"), expected: "1.6.1,1.6.0,1.5.6,1.4.0"},
+	}
+	for _, v := range cases {
+		releases, err := NewAnnouncedTfReleases(&staticTfReleases{source}, v.announced).List(context.Background())
+		if err != nil {
+			t.Fatalf("Failed of error: %s", err)
+		}
+		var got []string
+		for _, r := range releases {
+			got = append(got, r.SemanticVersion.String())
+		}
+		if strings.Join(got, ",") != v.expected {
+			t.Errorf("Failed: want = %s / got = %v", v.expected, got)
+		}
+	}
+	// the releases of the source are not changed
+	if len(source) != 2 {
+		t.Errorf("Failed: want = 2 releases in the source / got = %d", len(source))
+	}
+}
+
+type staticTfReleases struct {
+	releases []*TfRelease
+}
+
+func (t *staticTfReleases) List(ctx context.Context) ([]*TfRelease, error) {
+	return t.releases, nil
+}
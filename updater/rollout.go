@@ -0,0 +1,374 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Kinds of the wave selector
+const (
+	SelectTag     = "tag"
+	SelectName    = "name"
+	SelectProject = "project"
+)
+
+// Rollout statuses of the waves and the workspaces
+const (
+	// RolloutPending is the wave which waits for the previous waves
+	RolloutPending = "pending"
+	// RolloutUpdated is the wave or the workspace which is set to the new version just now
+	RolloutUpdated = "updated"
+	// RolloutWaiting is the workspace which has no finished run on the new version yet
+	RolloutWaiting = "waiting"
+	// RolloutSoaking is the workspace whose run on the new version succeeded, but not long enough ago
+	RolloutSoaking = "soaking"
+	RolloutHealthy = "healthy"
+	// RolloutFailed is the workspace whose latest run on the new version failed
+	RolloutFailed = "failed"
+	RolloutError  = "error"
+)
+
+// rolloutStatusOrder orders the statuses from the best, and the wave has the worst status of its workspaces
+var rolloutStatusOrder = []string{RolloutHealthy, RolloutSoaking, RolloutUpdated, RolloutWaiting, RolloutFailed, RolloutError}
+
+// WaveSelector selects the workspaces by the tag, the name glob or the project
+type WaveSelector struct {
+	Kind  string
+	Value string
+}
+
+func (s *WaveSelector) String() string {
+	return s.Kind + ":" + s.Value
+}
+
+// Wave is the workspaces which are set to the new version at once in the rollout
+type Wave struct {
+	Name      string
+	Selectors []*WaveSelector
+}
+
+// NewWave creates a new Wave from the comma separated selectors, like "tag:dev,name:sandbox-*".
+// A selector without the kind is a name glob.
+func NewWave(s string) (*Wave, error) {
+	wave := &Wave{Name: s}
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		selector := &WaveSelector{Kind: SelectName, Value: v}
+		if i := strings.Index(v, ":"); i >= 0 {
+			selector = &WaveSelector{Kind: v[:i], Value: v[i+1:]}
+		}
+
+		switch selector.Kind {
+		case SelectTag, SelectProject:
+		case SelectName:
+			if _, err := path.Match(selector.Value, ""); err != nil {
+				return nil, fmt.Errorf("Invalid name glob %q in wave %q", selector.Value, s)
+			}
+		default:
+			return nil, fmt.Errorf("Unknown selector %q in wave %q. It must be tag, name or project", selector.Kind, s)
+		}
+		if selector.Value == "" {
+			return nil, fmt.Errorf("Empty selector in wave %q", s)
+		}
+		wave.Selectors = append(wave.Selectors, selector)
+	}
+	return wave, nil
+}
+
+// SelectWorkspaces returns the workspaces in the organization which any selector of the wave selects.
+// They share the settings with w.
+func (w *Workspace) SelectWorkspaces(ctx context.Context, wave *Wave) ([]*Workspace, error) {
+	var all []string
+	seen := map[string]bool{}
+	var workspaces []*Workspace
+	for _, s := range wave.Selectors {
+		var names []string
+		var err error
+		switch s.Kind {
+		case SelectTag:
+			names, err = w.client.ListTaggedWorkspaces(ctx, w.organization, s.Value)
+		case SelectProject:
+			names, err = w.client.ListWorkspaces(ctx, w.organization, s.Value)
+		case SelectName:
+			if all == nil {
+				if all, err = w.client.ListWorkspaces(ctx, w.organization, ""); err != nil {
+					return nil, err
+				}
+			}
+			for _, name := range all {
+				if ok, _ := path.Match(s.Value, name); ok {
+					names = append(names, name)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				workspaces = append(workspaces, w.ForWorkspace(name))
+			}
+		}
+	}
+	return workspaces, nil
+}
+
+// RolloutState is the progress of the rollout, which is saved to resume it
+type RolloutState struct {
+	Organization string       `json:"organization"`
+	Version      string       `json:"version"`
+	Waves        []*WaveState `json:"waves"`
+	// Complete is set once all the waves are healthy, so that the state can be replaced by the rollout of another version
+	Complete bool `json:"complete,omitempty"`
+}
+
+// WaveState is the progress of the wave
+type WaveState struct {
+	Name string `json:"name"`
+	// Workspaces are the workspaces set to the new version, which are fixed when the wave starts
+	Workspaces []string  `json:"workspaces"`
+	StartedAt  time.Time `json:"started_at"`
+	// Updated are the workspaces already set to the new version while the wave has not started,
+	// so that retrying the wave which partly failed doesn't set them and queue runs again
+	Updated []string `json:"updated,omitempty"`
+}
+
+// IsStarted returns whether the workspaces of the wave are set to the new version
+func (s *WaveState) IsStarted() bool {
+	return !s.StartedAt.IsZero()
+}
+
+// NewRolloutState creates the state of a new rollout
+func NewRolloutState(org string, version *SemanticVersion, waves []*Wave) *RolloutState {
+	state := &RolloutState{Organization: org, Version: version.String()}
+	for _, wave := range waves {
+		state.Waves = append(state.Waves, &WaveState{Name: wave.Name})
+	}
+	return state
+}
+
+// DefaultRolloutStatePath returns the rollout state path under $XDG_DATA_HOME
+func DefaultRolloutStatePath() string {
+	return filepath.Join(filepath.Dir(DefaultJournalPath()), "rollout.json")
+}
+
+// LoadRolloutState loads the rollout state file, or returns nil if it doesn't exist
+func LoadRolloutState(path string) (*RolloutState, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var state RolloutState
+	if err = json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("Broken rollout state %s: %s", path, err)
+	}
+	return &state, nil
+}
+
+// Save saves the rollout state to the file
+func (s *RolloutState) Save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// IsFor returns whether the state is the rollout of the same waves in the organization
+func (s *RolloutState) IsFor(org string, waves []*Wave) bool {
+	if s.Organization != org || len(s.Waves) != len(waves) {
+		return false
+	}
+	for i, wave := range waves {
+		if s.Waves[i].Name != wave.Name {
+			return false
+		}
+	}
+	return true
+}
+
+// RolloutOptions is options of the rollout
+type RolloutOptions struct {
+	// Soak is how long the runs on the new version must have succeeded before the next wave starts
+	Soak time.Duration
+	// QueueRun queues a run after setting the workspace to the new version
+	QueueRun bool
+}
+
+// RolloutResult is the result of a step of the rollout
+type RolloutResult struct {
+	Version string        `json:"version"`
+	Waves   []*WaveResult `json:"waves"`
+	// Complete is true if the workspaces in all the waves are healthy
+	Complete bool `json:"complete"`
+}
+
+// WaveResult is the status of the wave
+type WaveResult struct {
+	Name       string                    `json:"name"`
+	Status     string                    `json:"status"`
+	Workspaces []*RolloutWorkspaceResult `json:"workspaces,omitempty"`
+}
+
+// RolloutWorkspaceResult is the status of the workspace in the wave
+type RolloutWorkspaceResult struct {
+	Workspace string `json:"workspace"`
+	Status    string `json:"status"`
+	Run       string `json:"run,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Rollout advances the rollout by one step at now.
+// The waves which have started are checked with the latest runs of their workspaces,
+// and the first wave which has not started is set to the new version only if all the previous waves are healthy.
+// The state is updated except in the dry run mode, and the caller saves it.
+// Errors of the workspaces are not returned but recorded in the result, so that one workspace doesn't stop checking others.
+func (w *Workspace) Rollout(ctx context.Context, state *RolloutState, waves []*Wave, opts *RolloutOptions, now time.Time) (*RolloutResult, error) {
+	version, err := NewSemanticVersion(state.Version)
+	if err != nil {
+		return nil, err
+	}
+	if !state.IsFor(w.organization, waves) {
+		return nil, fmt.Errorf("The rollout state is for other waves or organization")
+	}
+
+	result := &RolloutResult{Version: state.Version}
+	blocked := false
+	for i, wave := range waves {
+		ws := state.Waves[i]
+		wr := &WaveResult{Name: wave.Name, Status: RolloutHealthy}
+		result.Waves = append(result.Waves, wr)
+
+		switch {
+		case blocked:
+			wr.Status = RolloutPending
+		case !ws.IsStarted():
+			w.startWave(ctx, wave, ws, version, opts, now, wr)
+			blocked = true
+		default:
+			for _, name := range ws.Workspaces {
+				wr.add(w.ForWorkspace(name).checkRollout(ctx, version, opts.Soak, now))
+			}
+			blocked = wr.Status != RolloutHealthy
+		}
+	}
+	result.Complete = !blocked
+	if result.Complete && !w.dryRun {
+		state.Complete = true
+	}
+	return result, nil
+}
+
+// startWave sets the workspaces of the wave to the version, except the ones set by the previous tries.
+// The wave is marked as started only if all of them are set.
+func (w *Workspace) startWave(ctx context.Context, wave *Wave, ws *WaveState, version *SemanticVersion, opts *RolloutOptions, now time.Time, wr *WaveResult) {
+	wr.Status = RolloutUpdated
+	workspaces, err := w.SelectWorkspaces(ctx, wave)
+	if err != nil {
+		wr.add(&RolloutWorkspaceResult{Status: RolloutError, Error: err.Error()})
+		return
+	}
+
+	updated := map[string]bool{}
+	for _, name := range ws.Updated {
+		updated[name] = true
+	}
+
+	target := PinnedWorkspaceVersion(version)
+	names := make([]string, len(workspaces))
+	for i, x := range workspaces {
+		names[i] = x.workspace
+		r := &RolloutWorkspaceResult{Workspace: x.workspace, Status: RolloutUpdated}
+		if updated[x.workspace] {
+			wr.add(r)
+			continue
+		}
+		if err := x.SetWorkspaceVersion(ctx, target); err != nil {
+			r.Status = RolloutError
+			r.Error = err.Error()
+		} else if opts.QueueRun && !w.dryRun {
+			run, err := x.QueueRun(ctx, fmt.Sprintf("Roll out Terraform %s by terraform-cloud-updater", version))
+			if err != nil {
+				r.Status = RolloutError
+				r.Error = fmt.Sprintf("Failed to queue a run: %s", err)
+			} else {
+				r.Run = x.GetRunLink(run)
+			}
+		}
+		if r.Status == RolloutUpdated && !w.dryRun {
+			ws.Updated = append(ws.Updated, x.workspace)
+		}
+		wr.add(r)
+	}
+
+	if wr.Status == RolloutUpdated && !w.dryRun {
+		ws.Workspaces = names
+		ws.StartedAt = now
+		ws.Updated = nil
+	}
+}
+
+// checkRollout checks the latest run of the workspace on the version.
+// A run which planned no changes is also a success on the version, but plan-only runs never count.
+func (w *Workspace) checkRollout(ctx context.Context, version *SemanticVersion, soak time.Duration, now time.Time) *RolloutWorkspaceResult {
+	result := &RolloutWorkspaceResult{Workspace: w.workspace}
+	run, err := w.client.ReadLatestRun(ctx, w.organization, w.workspace)
+	if err != nil {
+		result.Status = RolloutError
+		result.Error = err.Error()
+		return result
+	}
+	if run == nil || run.TerraformVersion != version.String() {
+		result.Status = RolloutWaiting
+		return result
+	}
+
+	result.Run = w.GetRunLink(run)
+	succeeded := run.Status == RunApplied || (run.Status == RunPlannedAndFinished && !run.PlanOnly)
+	switch {
+	case succeeded && now.Sub(run.FinishedAt) >= soak:
+		result.Status = RolloutHealthy
+	case succeeded:
+		result.Status = RolloutSoaking
+	case run.Status == RunPlannedAndFinished:
+		result.Status = RolloutWaiting
+	case run.IsFinished():
+		result.Status = RolloutFailed
+		result.Error = fmt.Sprintf("The latest run on %s is %s", version, run.Status)
+	default:
+		result.Status = RolloutWaiting
+	}
+	return result
+}
+
+// add adds the workspace result, and makes the wave status the worst of its workspaces
+func (r *WaveResult) add(ws *RolloutWorkspaceResult) {
+	r.Workspaces = append(r.Workspaces, ws)
+	if rolloutStatusRank(ws.Status) > rolloutStatusRank(r.Status) {
+		r.Status = ws.Status
+	}
+}
+
+func rolloutStatusRank(status string) int {
+	for i, s := range rolloutStatusOrder {
+		if s == status {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,209 @@
+package updater
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewWave(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected []*WaveSelector
+		err      bool
+	}{
+		{src: "tag:dev", expected: []*WaveSelector{{Kind: SelectTag, Value: "dev"}}},
+		{src: "stg-*", expected: []*WaveSelector{{Kind: SelectName, Value: "stg-*"}}},
+		{src: "project:prod, name:prd-*", expected: []*WaveSelector{{Kind: SelectProject, Value: "prod"}, {Kind: SelectName, Value: "prd-*"}}},
+		{src: "label:prod", err: true},
+		{src: "tag:", err: true},
+		{src: "name:[prd", err: true},
+	}
+
+	for _, v := range cases {
+		got, err := NewWave(v.src)
+		if (err != nil) != v.err {
+			t.Errorf("Failed: src = %s / want error = %t / got = %v", v.src, v.err, err)
+		} else if err == nil && !reflect.DeepEqual(got.Selectors, v.expected) {
+			t.Errorf("Failed: src = %s / want = %v / got = %v", v.src, v.expected, got.Selectors)
+		}
+	}
+}
+
+func TestRollout(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	applied := func(version string, age time.Duration) *Run {
+		return &Run{ID: "run-mock", Status: RunApplied, TerraformVersion: version, FinishedAt: now.Add(-age)}
+	}
+
+	var waves []*Wave
+	for _, s := range []string{"tag:dev", "name:stg-*", "project:prod"} {
+		wave, err := NewWave(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waves = append(waves, wave)
+	}
+
+	// each step continues the rollout with the runs
+	cases := []struct {
+		runs     map[string]*Run
+		dryRun   bool
+		expected []string
+		complete bool
+	}{
+		{dryRun: true, expected: []string{RolloutUpdated, RolloutPending, RolloutPending}},
+		{expected: []string{RolloutUpdated, RolloutPending, RolloutPending}},
+		{expected: []string{RolloutWaiting, RolloutPending, RolloutPending}},
+		{
+			runs:     map[string]*Run{"dev-1": applied("0.12.25", 48*time.Hour), "dev-2": applied("0.12.25", time.Hour)},
+			expected: []string{RolloutSoaking, RolloutPending, RolloutPending},
+		},
+		{
+			runs:     map[string]*Run{"dev-1": applied("0.12.25", 48*time.Hour), "dev-2": applied("0.12.25", 25*time.Hour)},
+			expected: []string{RolloutHealthy, RolloutUpdated, RolloutPending},
+		},
+		{
+			runs: map[string]*Run{
+				"dev-1": applied("0.12.25", 48*time.Hour), "dev-2": applied("0.12.25", 25*time.Hour),
+				"stg-1": {ID: "run-mock", Status: RunErrored, TerraformVersion: "0.12.25"},
+			},
+			expected: []string{RolloutHealthy, RolloutFailed, RolloutPending},
+		},
+		{
+			runs: map[string]*Run{
+				"dev-1": applied("0.12.25", 48*time.Hour), "dev-2": applied("0.12.25", 25*time.Hour),
+				"stg-1": applied("0.12.25", 30*time.Hour),
+			},
+			expected: []string{RolloutHealthy, RolloutHealthy, RolloutUpdated},
+		},
+		{
+			runs: map[string]*Run{
+				"dev-1": applied("0.12.25", 48*time.Hour), "dev-2": applied("0.12.25", 25*time.Hour),
+				"stg-1": applied("0.12.25", 30*time.Hour), "prd-1": applied("0.12.24", 30*time.Hour),
+			},
+			expected: []string{RolloutHealthy, RolloutHealthy, RolloutWaiting},
+		},
+		{
+			runs: map[string]*Run{
+				"dev-1": applied("0.12.25", 48*time.Hour), "dev-2": applied("0.12.25", 25*time.Hour),
+				"stg-1": applied("0.12.25", 30*time.Hour), "prd-1": applied("0.12.25", 30*time.Hour),
+			},
+			expected: []string{RolloutHealthy, RolloutHealthy, RolloutHealthy},
+			complete: true,
+		},
+	}
+
+	client := &TfCloudMock{
+		version:  &SemanticVersion{Versions: []int{0, 12, 24}},
+		projects: map[string][]string{"": {"dev-1", "dev-2", "stg-1", "prd-1"}, "prod": {"prd-1"}},
+		tags:     map[string][]string{"dev": {"dev-1", "dev-2"}},
+	}
+	w := &Workspace{client: client, tfRelease: &TfReleasesMock{}, organization: "chroju", workspace: "sample"}
+	state := NewRolloutState("chroju", &SemanticVersion{Versions: []int{0, 12, 25}}, waves)
+	opts := &RolloutOptions{Soak: 24 * time.Hour}
+
+	for i, v := range cases {
+		client.latestRuns = v.runs
+		w.SetDryRun(v.dryRun)
+
+		result, err := w.Rollout(context.Background(), state, waves, opts, now)
+		if err != nil {
+			t.Fatalf("Failed of error: %s", err)
+		}
+		var got []string
+		for _, wave := range result.Waves {
+			got = append(got, wave.Status)
+		}
+		if !reflect.DeepEqual(got, v.expected) || result.Complete != v.complete {
+			t.Errorf("Failed: step = %d / want = %v, %t / got = %v, %t", i, v.expected, v.complete, got, result.Complete)
+		}
+	}
+
+	if !state.Complete {
+		t.Errorf("Failed: want the complete state / got = %+v", state)
+	}
+
+	expected := [][]string{{"dev-1", "dev-2"}, {"stg-1"}, {"prd-1"}}
+	for i, ws := range state.Waves {
+		if !reflect.DeepEqual(ws.Workspaces, expected[i]) || !ws.StartedAt.Equal(now) {
+			t.Errorf("Failed: wave = %s / want = %v / got = %+v", ws.Name, expected[i], ws)
+		}
+	}
+
+	if _, err := w.Rollout(context.Background(), state, waves[:2], opts, now); err == nil {
+		t.Errorf("Failed: want error for other waves / got = nil")
+	}
+}
+
+func TestRolloutRetry(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	wave, err := NewWave("tag:dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waves := []*Wave{wave}
+
+	client := &TfCloudMock{
+		version:     &SemanticVersion{Versions: []int{0, 12, 24}},
+		tags:        map[string][]string{"dev": {"dev-1", "dev-2"}},
+		failUpdates: map[string]bool{"dev-2": true},
+	}
+	w := &Workspace{client: client, tfRelease: &TfReleasesMock{}, organization: "chroju", workspace: "sample"}
+	state := NewRolloutState("chroju", &SemanticVersion{Versions: []int{0, 12, 25}}, waves)
+	opts := &RolloutOptions{Soak: 24 * time.Hour, QueueRun: true}
+
+	// dev-2 fails, and only dev-1 is recorded
+	result, err := w.Rollout(context.Background(), state, waves, opts, now)
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if result.Waves[0].Status != RolloutError || state.Waves[0].IsStarted() || !reflect.DeepEqual(state.Waves[0].Updated, []string{"dev-1"}) {
+		t.Errorf("Failed: want = error with dev-1 updated / got = %s, %+v", result.Waves[0].Status, state.Waves[0])
+	}
+
+	// the retry sets only dev-2, and starts the wave
+	client.failUpdates = nil
+	client.updated = nil
+	result, err = w.Rollout(context.Background(), state, waves, opts, now)
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if result.Waves[0].Status != RolloutUpdated || !reflect.DeepEqual(client.updated, []string{"dev-2"}) {
+		t.Errorf("Failed: want = updated with dev-2 / got = %s, %v", result.Waves[0].Status, client.updated)
+	}
+	if !state.Waves[0].IsStarted() || !reflect.DeepEqual(state.Waves[0].Workspaces, []string{"dev-1", "dev-2"}) || state.Waves[0].Updated != nil {
+		t.Errorf("Failed: want = started with dev-1, dev-2 / got = %+v", state.Waves[0])
+	}
+
+	// the plan-only run is not a success
+	client.latestRuns = map[string]*Run{
+		"dev-1": {ID: "run-mock", Status: RunPlannedAndFinished, PlanOnly: true, TerraformVersion: "0.12.25", FinishedAt: now.Add(-48 * time.Hour)},
+		"dev-2": {ID: "run-mock", Status: RunApplied, TerraformVersion: "0.12.25", FinishedAt: now.Add(-48 * time.Hour)},
+	}
+	result, err = w.Rollout(context.Background(), state, waves, opts, now)
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if result.Waves[0].Status != RolloutWaiting || result.Complete {
+		t.Errorf("Failed: want = waiting / got = %s, %t", result.Waves[0].Status, result.Complete)
+	}
+
+	// the run which planned no changes is a success, and soaks from when it finished
+	client.latestRuns["dev-1"] = &Run{ID: "run-mock", Status: RunPlannedAndFinished, TerraformVersion: "0.12.25", FinishedAt: now.Add(-time.Hour)}
+	result, err = w.Rollout(context.Background(), state, waves, opts, now)
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if result.Waves[0].Status != RolloutSoaking || result.Complete {
+		t.Errorf("Failed: want = soaking / got = %s, %t", result.Waves[0].Status, result.Complete)
+	}
+	result, err = w.Rollout(context.Background(), state, waves, opts, now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if result.Waves[0].Status != RolloutHealthy || !result.Complete {
+		t.Errorf("Failed: want = healthy / got = %s, %t", result.Waves[0].Status, result.Complete)
+	}
+}
@@ -0,0 +1,150 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Run statuses which this tool cares about. See the Terraform Cloud runs API for the others.
+const (
+	RunApplied            = "applied"
+	RunPlannedAndFinished = "planned_and_finished"
+	RunErrored            = "errored"
+	RunCanceled           = "canceled"
+	RunForceCanceled      = "force_canceled"
+	RunDiscarded          = "discarded"
+)
+
+// runPollInterval is the interval to poll the run status
+var runPollInterval = 5 * time.Second
+
+// cleanupTimeout is the timeout to clean up changes, like canceling the run or unlock, after the context is canceled
+const cleanupTimeout = time.Minute
+
+// Run represents Terraform Cloud run
+type Run struct {
+	ID          string
+	Status      string
+	PlanOnly    bool
+	Confirmable bool
+	// TerraformVersion and FinishedAt are set only by ReadLatestRun
+	TerraformVersion string
+	FinishedAt       time.Time
+}
+
+// RunOptions is options to create a new run
+type RunOptions struct {
+	Message  string
+	PlanOnly bool
+	// TerraformVersion runs the plan-only run on the version, instead of the version of the workspace.
+	// Terraform Cloud accepts it only for plan-only runs.
+	TerraformVersion string
+}
+
+// IsFinished returns whether the run has reached the final status
+func (r *Run) IsFinished() bool {
+	switch r.Status {
+	case RunApplied, RunPlannedAndFinished, RunErrored, RunCanceled, RunForceCanceled, RunDiscarded:
+		return true
+	}
+	return false
+}
+
+// IsSettled returns whether the run has finished, or is waiting for a confirmation by someone
+func (r *Run) IsSettled() bool {
+	return r.IsFinished() || r.Confirmable
+}
+
+// IsSucceeded returns whether the run has finished successfully
+func (r *Run) IsSucceeded() bool {
+	return r.Status == RunApplied || r.Status == RunPlannedAndFinished
+}
+
+// GetRunLink get the run link
+func (w *Workspace) GetRunLink(r *Run) string {
+	return fmt.Sprintf("https://%s/app/%s/workspaces/%s/runs/%s", w.hostname, w.organization, w.workspace, r.ID)
+}
+
+// WaitRun polls the run status until the done function returns true, or the timeout is exceeded.
+// The last known run is returned with the error, so that the caller can still cancel it.
+func (w *Workspace) WaitRun(ctx context.Context, r *Run, timeout time.Duration, done func(*Run) bool) (*Run, error) {
+	deadline := time.Now().Add(timeout)
+	for !done(r) {
+		if time.Now().After(deadline) {
+			return r, fmt.Errorf("Timed out waiting for run %s (status: %s)", r.ID, r.Status)
+		}
+		if err := sleep(ctx, runPollInterval); err != nil {
+			return r, err
+		}
+
+		latest, err := w.client.ReadRun(ctx, r.ID)
+		if err != nil {
+			return r, err
+		}
+		r = latest
+	}
+	return r, nil
+}
+
+// QueueRun queues a new run on the workspace
+func (w *Workspace) QueueRun(ctx context.Context, message string) (*Run, error) {
+	return w.client.CreateRun(ctx, w.organization, w.workspace, &RunOptions{Message: message})
+}
+
+// VerifyAndUpdateVersion verifies the version with a plan-only run on it, and updates terraform cloud workspace terraform version if the plan succeeds.
+// The workspace keeps the current version during the verification, so that other runs never use the version which is not verified yet.
+func (w *Workspace) VerifyAndUpdateVersion(ctx context.Context, v *WorkspaceVersion, timeout time.Duration) (*Run, error) {
+	if err := w.checkWorkspaceVersion(ctx, v); err != nil {
+		return nil, err
+	}
+	s, err := w.ResolveWorkspaceVersion(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	if w.dryRun {
+		return nil, w.whenIdle(ctx, func() error { return nil })
+	}
+
+	run, err := w.client.CreateRun(ctx, w.organization, w.workspace, &RunOptions{
+		Message:          fmt.Sprintf("Verify Terraform %s by terraform-cloud-updater", v),
+		PlanOnly:         true,
+		TerraformVersion: s.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	run, err = w.WaitRun(ctx, run, timeout, (*Run).IsFinished)
+	if err == nil && run.IsSucceeded() {
+		return run, w.SetWorkspaceVersion(ctx, v)
+	}
+
+	// cancel the run which is still running on the version.
+	// The given context may be already canceled, so cancel with another one.
+	if !run.IsFinished() {
+		cleanupCtx, cancel := newCleanupContext()
+		defer cancel()
+		if cancelErr := w.client.CancelRun(cleanupCtx, run.ID); cancelErr != nil {
+			return run, fmt.Errorf("Verification of %s failed, and failed to cancel run %s: %s (%s)", v, run.ID, cancelErr, err)
+		}
+	}
+	if err != nil {
+		return run, fmt.Errorf("Verification of %s failed, the workspace was not changed: %s", v, err)
+	}
+	return run, fmt.Errorf("Plan on %s finished with status %s, the workspace was not changed", v, run.Status)
+}
+
+// sleep waits for the duration, or returns the error when the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// newCleanupContext returns the context not to be canceled with the parent one, to clean up changes
+func newCleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), cleanupTimeout)
+}
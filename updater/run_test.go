@@ -0,0 +1,189 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVerifyAndUpdateVersion(t *testing.T) {
+	runPollInterval = time.Millisecond
+
+	cases := []struct {
+		runStatuses []string
+		expected    *SemanticVersion
+		expectError bool
+		canceled    bool
+	}{
+		{
+			runStatuses: []string{"plan_queued", "planning", RunPlannedAndFinished},
+			expected:    &SemanticVersion{Versions: []int{0, 12, 25}},
+			expectError: false,
+		},
+		{
+			runStatuses: []string{"planning", RunErrored},
+			expected:    &SemanticVersion{Versions: []int{0, 12, 20}},
+			expectError: true,
+		},
+		// the run is canceled on the timeout
+		{
+			runStatuses: []string{"planning"},
+			expected:    &SemanticVersion{Versions: []int{0, 12, 20}},
+			expectError: true,
+			canceled:    true,
+		},
+	}
+
+	for _, v := range cases {
+		client := &TfCloudMock{
+			version:     &SemanticVersion{Versions: []int{0, 12, 20}},
+			runStatuses: v.runStatuses,
+		}
+		w := &Workspace{
+			client:    client,
+			tfRelease: &TfReleasesMock{},
+		}
+
+		run, err := w.VerifyAndUpdateVersion(context.Background(), PinnedWorkspaceVersion(&SemanticVersion{Versions: []int{0, 12, 25}}), 50*time.Millisecond)
+		if (err != nil) != v.expectError {
+			t.Errorf("Failed: runStatuses = %v / want error = %v / got = %v", v.runStatuses, v.expectError, err)
+		}
+		if run == nil || run.Status != v.runStatuses[len(v.runStatuses)-1] {
+			t.Errorf("Failed: runStatuses = %v / run = %+v", v.runStatuses, run)
+		}
+		if !reflect.DeepEqual(client.version, v.expected) {
+			t.Errorf("Failed: runStatuses = %v / want = %v / got = %v", v.runStatuses, v.expected, client.version)
+		}
+		// the plan runs on the new version, while the workspace keeps the current version
+		if !client.runOptions.PlanOnly || client.runOptions.TerraformVersion != "0.12.25" {
+			t.Errorf("Failed: runStatuses = %v / want plan-only run on 0.12.25 / got = %+v", v.runStatuses, client.runOptions)
+		}
+		for _, version := range client.runVersions {
+			if version != "0.12.20" {
+				t.Errorf("Failed: runStatuses = %v / want workspace version = 0.12.20 during the run / got = %s", v.runStatuses, version)
+				break
+			}
+		}
+		if (len(client.canceled) > 0) != v.canceled {
+			t.Errorf("Failed: runStatuses = %v / want canceled = %t / got = %v", v.runStatuses, v.canceled, client.canceled)
+		}
+	}
+}
+
+func TestVerifyAndUpdateVersionReadRunError(t *testing.T) {
+	runPollInterval = time.Millisecond
+
+	client := &TfCloudMock{
+		version:      &SemanticVersion{Versions: []int{0, 12, 20}},
+		readRunError: fmt.Errorf("Internal Server Error"),
+	}
+	w := &Workspace{
+		client:    client,
+		tfRelease: &TfReleasesMock{},
+	}
+
+	run, err := w.VerifyAndUpdateVersion(context.Background(), PinnedWorkspaceVersion(&SemanticVersion{Versions: []int{0, 12, 25}}), time.Second)
+	if err == nil {
+		t.Errorf("Failed: want error / got = nil")
+	}
+	if run == nil || run.ID != "run-mock" {
+		t.Errorf("Failed: want = run-mock / got = %+v", run)
+	}
+	// the plan-only run is canceled, even though its status is unknown
+	if !reflect.DeepEqual(client.canceled, []string{"run-mock"}) {
+		t.Errorf("Failed: want canceled = [run-mock] / got = %v", client.canceled)
+	}
+	if client.version.String() != "0.12.20" {
+		t.Errorf("Failed: want = 0.12.20 / got = %s", client.version)
+	}
+}
+
+func TestWaitRun(t *testing.T) {
+	runPollInterval = time.Millisecond
+
+	cases := []struct {
+		runStatuses []string
+		done        func(*Run) bool
+		expected    string
+	}{
+		{
+			runStatuses: []string{"plan_queued", "planning", "planned", "applying", RunApplied},
+			done:        (*Run).IsSettled,
+			expected:    "planned",
+		},
+		{
+			runStatuses: []string{"plan_queued", "planning", "planned", "applying", RunApplied},
+			done:        (*Run).IsFinished,
+			expected:    RunApplied,
+		},
+	}
+
+	for _, v := range cases {
+		w := &Workspace{
+			client: &TfCloudMock{runStatuses: v.runStatuses},
+		}
+
+		run, err := w.QueueRun(context.Background(), "test")
+		if err != nil {
+			t.Fatalf("Failed of error: %s", err)
+		}
+		run, err = w.WaitRun(context.Background(), run, time.Second, v.done)
+		if err != nil {
+			t.Errorf("Failed of error: %s / runStatuses = %v", err, v.runStatuses)
+		} else if run.Status != v.expected {
+			t.Errorf("Failed: runStatuses = %v / want = %s / got = %s", v.runStatuses, v.expected, run.Status)
+		}
+	}
+}
+
+func TestWaitRunCanceled(t *testing.T) {
+	runPollInterval = time.Millisecond
+
+	w := &Workspace{
+		client: &TfCloudMock{runStatuses: []string{"plan_queued", "planning", "planned", RunApplied}},
+	}
+	run, err := w.QueueRun(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = w.WaitRun(ctx, run, time.Second, (*Run).IsFinished); err != context.Canceled {
+		t.Errorf("Failed: want = %s / got = %v", context.Canceled, err)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	cases := []struct {
+		hostname string
+		settings string
+		run      string
+	}{
+		{
+			hostname: "",
+			settings: "https://app.terraform.io/app/chroju/workspaces/sample/settings/general",
+			run:      "https://app.terraform.io/app/chroju/workspaces/sample/runs/run-1",
+		},
+		{
+			hostname: "tfe.example.com",
+			settings: "https://tfe.example.com/app/chroju/workspaces/sample/settings/general",
+			run:      "https://tfe.example.com/app/chroju/workspaces/sample/runs/run-1",
+		},
+	}
+
+	for _, v := range cases {
+		w, err := NewWorkspace(&TfCloudMock{}, &Config{Hostname: v.hostname, Organization: "chroju", Workspace: "sample", Releases: &TfReleasesMock{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := w.GetSettingsLink(); got != v.settings {
+			t.Errorf("Failed: hostname = %s / want = %s / got = %s", v.hostname, v.settings, got)
+		}
+		if got := w.GetRunLink(&Run{ID: "run-1"}); got != v.run {
+			t.Errorf("Failed: hostname = %s / want = %s / got = %s", v.hostname, v.run, got)
+		}
+	}
+}
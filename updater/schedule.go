@@ -0,0 +1,266 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// scheduleHorizon is how far the next allowed time is searched
+const scheduleHorizon = 2 * 366 * 24 * time.Hour
+
+// timeNow is the clock to check the schedule, which is replaced in tests
+var timeNow = time.Now
+
+// MaintenanceWindow is the time of the week when the matching workspaces may be changed.
+// If any window matches the workspace, it may be changed only in one of the matching windows.
+type MaintenanceWindow struct {
+	Name string
+	// Workspaces and Tags select the workspaces in the same way as Rule. The window applies to every workspace without them.
+	Workspaces []string
+	Tags       []string
+	// Days are the days of the week when the window starts. The window starts every day if it is empty.
+	Days []time.Weekday
+	// Start and End are minutes from the midnight. The window ends on the next day if End is not after Start.
+	Start    int
+	End      int
+	Location *time.Location
+	// Source is where the window is declared, like ".tfc-updater.hcl:3". It is empty if unknown.
+	Source string
+}
+
+func (m *MaintenanceWindow) String() string {
+	return fmt.Sprintf("maintenance_window %q", m.Name)
+}
+
+// Describe returns the window in a human readable form, like "Mon Tue 02:00-04:00 UTC"
+func (m *MaintenanceWindow) Describe() string {
+	days := "every day"
+	if len(m.Days) > 0 {
+		names := make([]string, len(m.Days))
+		for i, d := range m.Days {
+			names[i] = d.String()[:3]
+		}
+		days = strings.Join(names, " ")
+	}
+	return fmt.Sprintf("%s %02d:%02d-%02d:%02d %s", days, m.Start/60, m.Start%60, m.End/60, m.End%60, m.Location)
+}
+
+// Contains returns whether t is in the window
+func (m *MaintenanceWindow) Contains(t time.Time) bool {
+	lt := t.In(m.Location)
+	minutes := lt.Hour()*60 + lt.Minute()
+	if m.Start < m.End {
+		return m.startsOn(lt.Weekday()) && m.Start <= minutes && minutes < m.End
+	}
+	// the window crosses the midnight
+	return (m.startsOn(lt.Weekday()) && minutes >= m.Start) || (m.startsOn((lt.Weekday()+6)%7) && minutes < m.End)
+}
+
+func (m *MaintenanceWindow) startsOn(d time.Weekday) bool {
+	if len(m.Days) == 0 {
+		return true
+	}
+	for _, v := range m.Days {
+		if v == d {
+			return true
+		}
+	}
+	return false
+}
+
+// starts returns the start times of the window from the day of from, until to
+func (m *MaintenanceWindow) starts(from, to time.Time) []time.Time {
+	var starts []time.Time
+	lf := from.In(m.Location)
+	for day := time.Date(lf.Year(), lf.Month(), lf.Day(), 0, 0, 0, 0, m.Location); day.Before(to); day = day.AddDate(0, 0, 1) {
+		if m.startsOn(day.Weekday()) {
+			starts = append(starts, time.Date(day.Year(), day.Month(), day.Day(), m.Start/60, m.Start%60, 0, 0, m.Location))
+		}
+	}
+	return starts
+}
+
+// FreezeDate is the date of the freeze. Year is 0 if the freeze recurs every year.
+type FreezeDate struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+func (d FreezeDate) String() string {
+	if d.Year == 0 {
+		return fmt.Sprintf("%02d-%02d", d.Month, d.Day)
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// Freeze is the dates when the matching workspaces must not be changed, like a code freeze
+type Freeze struct {
+	Name string
+	// Workspaces and Tags select the workspaces in the same way as Rule. The freeze applies to every workspace without them.
+	Workspaces []string
+	Tags       []string
+	// Start and End are the first and the last days of the freeze. Both of them recur every year, or neither.
+	Start    FreezeDate
+	End      FreezeDate
+	Location *time.Location
+	Reason   string
+	// Source is where the freeze is declared, like ".tfc-updater.hcl:3". It is empty if unknown.
+	Source string
+}
+
+func (f *Freeze) String() string {
+	return fmt.Sprintf("freeze %q", f.Name)
+}
+
+// Describe returns the freeze in a human readable form, like "12-01 - 12-31 UTC"
+func (f *Freeze) Describe() string {
+	return fmt.Sprintf("%s - %s %s", f.Start, f.End, f.Location)
+}
+
+// Contains returns whether t is in the freeze
+func (f *Freeze) Contains(t time.Time) bool {
+	lt := t.In(f.Location)
+	if f.Start.Year != 0 {
+		date := lt.Year()*10000 + int(lt.Month())*100 + lt.Day()
+		return f.Start.Year*10000+int(f.Start.Month)*100+f.Start.Day <= date && date <= f.End.Year*10000+int(f.End.Month)*100+f.End.Day
+	}
+
+	date := int(lt.Month())*100 + lt.Day()
+	start, end := int(f.Start.Month)*100+f.Start.Day, int(f.End.Month)*100+f.End.Day
+	if start <= end {
+		return start <= date && date <= end
+	}
+	// the freeze crosses the new year
+	return date >= start || date <= end
+}
+
+// ends returns the times just after the freeze ends, around t
+func (f *Freeze) ends(t time.Time) []time.Time {
+	if f.Start.Year != 0 {
+		return []time.Time{time.Date(f.End.Year, f.End.Month, f.End.Day+1, 0, 0, 0, 0, f.Location)}
+	}
+	year := t.In(f.Location).Year()
+	var ends []time.Time
+	for y := year - 1; y <= year+2; y++ {
+		ends = append(ends, time.Date(y, f.End.Month, f.End.Day+1, 0, 0, 0, 0, f.Location))
+	}
+	return ends
+}
+
+// ScheduleError is the error for the change outside of the maintenance windows, or in a freeze
+type ScheduleError struct {
+	Workspace string
+	Reason    string
+	// Next is the next time when the workspace may be changed. It is zero if there is no such time in two years.
+	Next time.Time
+}
+
+func (e *ScheduleError) Error() string {
+	next := "no allowed time in two years"
+	if !e.Next.IsZero() {
+		next = e.Next.Format("2006-01-02 15:04 MST")
+	}
+	return fmt.Sprintf("Workspace %s can't be changed now, because it is %s. Next allowed time: %s", e.Workspace, e.Reason, next)
+}
+
+// CheckSchedule checks the workspace may be changed at now.
+// It returns *ScheduleError if the workspace is in a freeze, or outside of the maintenance windows.
+func (p *Policy) CheckSchedule(workspace string, scope *WorkspaceScope, now time.Time) error {
+	windows, freezes := p.matchSchedule(workspace, scope)
+	reason := scheduleReason(windows, freezes, now)
+	if reason == "" {
+		return nil
+	}
+	return &ScheduleError{Workspace: workspace, Reason: reason, Next: nextAllowedTime(windows, freezes, now)}
+}
+
+// HasSchedule returns whether the policy has any maintenance window or freeze
+func (p *Policy) HasSchedule() bool {
+	return p != nil && (len(p.Windows) > 0 || len(p.Freezes) > 0)
+}
+
+func (p *Policy) matchSchedule(workspace string, scope *WorkspaceScope) ([]*MaintenanceWindow, []*Freeze) {
+	var windows []*MaintenanceWindow
+	for _, m := range p.Windows {
+		if matchWorkspace(m.Workspaces, m.Tags, workspace, scope) {
+			windows = append(windows, m)
+		}
+	}
+	var freezes []*Freeze
+	for _, f := range p.Freezes {
+		if matchWorkspace(f.Workspaces, f.Tags, workspace, scope) {
+			freezes = append(freezes, f)
+		}
+	}
+	return windows, freezes
+}
+
+// scheduleReason returns why the change is not allowed at t, or an empty string if it is allowed
+func scheduleReason(windows []*MaintenanceWindow, freezes []*Freeze, t time.Time) string {
+	for _, f := range freezes {
+		if f.Contains(t) {
+			reason := fmt.Sprintf("in %s (%s)", f, f.Describe())
+			if f.Reason != "" {
+				reason += ": " + f.Reason
+			}
+			return reason
+		}
+	}
+	if len(windows) == 0 {
+		return ""
+	}
+
+	descriptions := make([]string, len(windows))
+	for i, m := range windows {
+		if m.Contains(t) {
+			return ""
+		}
+		descriptions[i] = fmt.Sprintf("%s (%s)", m, m.Describe())
+	}
+	return "outside of " + strings.Join(descriptions, ", ")
+}
+
+// nextAllowedTime returns the first time after now when the change is allowed, or zero if there is no such time in the horizon.
+// Only the start times of the windows and the end times of the freezes can be the first allowed time.
+func nextAllowedTime(windows []*MaintenanceWindow, freezes []*Freeze, now time.Time) time.Time {
+	to := now.Add(scheduleHorizon)
+	var candidates []time.Time
+	for _, m := range windows {
+		candidates = append(candidates, m.starts(now, to)...)
+	}
+	for _, f := range freezes {
+		candidates = append(candidates, f.ends(now)...)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+
+	for _, t := range candidates {
+		if t.After(now) && t.Before(to) && scheduleReason(windows, freezes, t) == "" {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// SetSchedule sets the policy whose maintenance windows and freezes gate the version changes.
+// The changes are not gated if p is nil.
+func (w *Workspace) SetSchedule(p *Policy) {
+	w.schedule = p
+}
+
+// CheckSchedule checks the workspace may be changed at now, with the maintenance windows and the freezes of the policy.
+// It returns *ScheduleError if the workspace may not be changed.
+func (w *Workspace) CheckSchedule(ctx context.Context, p *Policy, now time.Time) error {
+	if !p.HasSchedule() {
+		return nil
+	}
+
+	scope, err := w.GetScope(ctx)
+	if err != nil {
+		return err
+	}
+	return p.CheckSchedule(w.workspace, scope, now)
+}
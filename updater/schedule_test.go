@@ -0,0 +1,130 @@
+package updater
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckSchedule(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	policy := &Policy{
+		Windows: []*MaintenanceWindow{
+			{Name: "prod", Tags: []string{"prod"}, Days: weekdays, Start: 2 * 60, End: 4 * 60, Location: time.UTC},
+			{Name: "jp", Workspaces: []string{"jp-*"}, Start: 22 * 60, End: 60, Location: tokyo},
+		},
+		Freezes: []*Freeze{
+			{Name: "december", Tags: []string{"prod"}, Start: FreezeDate{Month: time.December, Day: 1}, End: FreezeDate{Month: time.December, Day: 31}, Location: time.UTC},
+		},
+	}
+
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	prod := &WorkspaceScope{Tags: []string{"prod"}}
+	cases := []struct {
+		workspace string
+		scope     *WorkspaceScope
+		now       time.Time
+		next      time.Time
+		allowed   bool
+	}{
+		// 2026-10-01 is Thursday
+		{workspace: "network", scope: prod, now: utc(time.October, 1, 3, 0), allowed: true},
+		{workspace: "network", scope: prod, now: utc(time.October, 1, 1, 0), next: utc(time.October, 1, 2, 0)},
+		{workspace: "network", scope: prod, now: utc(time.October, 1, 4, 0), next: utc(time.October, 2, 2, 0)},
+		{workspace: "network", scope: prod, now: utc(time.October, 2, 5, 0), next: utc(time.October, 5, 2, 0)},
+		{workspace: "network", scope: prod, now: utc(time.October, 3, 3, 0), next: utc(time.October, 5, 2, 0)},
+		{workspace: "network", scope: prod, now: utc(time.December, 15, 3, 0), next: time.Date(2027, time.January, 1, 2, 0, 0, 0, time.UTC)},
+		{workspace: "network", scope: prod, now: utc(time.November, 30, 5, 0), next: time.Date(2027, time.January, 1, 2, 0, 0, 0, time.UTC)},
+		{workspace: "network", scope: &WorkspaceScope{}, now: utc(time.December, 15, 12, 0), allowed: true},
+		// the window crosses the midnight in Asia/Tokyo
+		{workspace: "jp-network", scope: &WorkspaceScope{}, now: utc(time.October, 1, 15, 30), allowed: true},
+		{workspace: "jp-network", scope: &WorkspaceScope{}, now: utc(time.October, 1, 17, 0), next: utc(time.October, 2, 13, 0)},
+	}
+
+	for _, v := range cases {
+		err := policy.CheckSchedule(v.workspace, v.scope, v.now)
+		if v.allowed {
+			if err != nil {
+				t.Errorf("Failed: workspace = %s / now = %s / want allowed / got = %s", v.workspace, v.now, err)
+			}
+			continue
+		}
+
+		scheduleErr, ok := err.(*ScheduleError)
+		if !ok {
+			t.Errorf("Failed: workspace = %s / now = %s / want ScheduleError / got = %v", v.workspace, v.now, err)
+		} else if !scheduleErr.Next.Equal(v.next) {
+			t.Errorf("Failed: workspace = %s / now = %s / want next = %s / got = %s", v.workspace, v.now, v.next, scheduleErr.Next)
+		}
+	}
+}
+
+func TestSetWorkspaceVersionInFreeze(t *testing.T) {
+	client := &TfCloudMock{version: &SemanticVersion{Versions: []int{0, 12, 24}}}
+	w := &Workspace{client: client, tfRelease: &TfReleasesMock{}, organization: "chroju", workspace: "sample"}
+	w.SetSchedule(&Policy{
+		Freezes: []*Freeze{
+			{Name: "always", Start: FreezeDate{Month: time.January, Day: 1}, End: FreezeDate{Month: time.December, Day: 31}, Location: time.UTC},
+		},
+	})
+
+	err := w.UpdateVersion(context.Background(), &SemanticVersion{Versions: []int{0, 12, 25}})
+	if scheduleErr, ok := err.(*ScheduleError); !ok || !scheduleErr.Next.IsZero() {
+		t.Errorf("Failed: want ScheduleError without the next time / got = %v", err)
+	}
+	if client.version.String() != "0.12.24" {
+		t.Errorf("Failed: want version = 0.12.24 / got = %s", client.version)
+	}
+}
+
+func TestSetWorkspaceVersionAfterWindow(t *testing.T) {
+	busyPollInterval = time.Millisecond
+	runPollInterval = time.Millisecond
+	defer func() { timeNow = time.Now }()
+
+	policy := &Policy{
+		Windows: []*MaintenanceWindow{{Name: "prod", Start: 2 * 60, End: 4 * 60, Location: time.UTC}},
+	}
+	active := &Run{ID: "run-active", Status: "applying"}
+	applied := &Run{ID: "run-active", Status: RunApplied}
+
+	for _, verify := range []bool{false, true} {
+		// the check passes at 03:59, and the workspace gets idle or the plan finishes at 04:09
+		clock := []time.Time{time.Date(2026, 10, 1, 3, 59, 0, 0, time.UTC), time.Date(2026, 10, 1, 4, 9, 0, 0, time.UTC)}
+		timeNow = func() time.Time {
+			now := clock[0]
+			if len(clock) > 1 {
+				clock = clock[1:]
+			}
+			return now
+		}
+
+		client := &TfCloudMock{
+			version:     &SemanticVersion{Versions: []int{0, 12, 24}},
+			statuses:    []*WorkspaceStatus{{CurrentRun: active}, {CurrentRun: applied}},
+			runStatuses: []string{RunPlannedAndFinished},
+		}
+		w := &Workspace{client: client, tfRelease: &TfReleasesMock{}, organization: "chroju", workspace: "sample"}
+		w.SetBusyPolicy(BusyWait, time.Second)
+		w.SetSchedule(policy)
+
+		var err error
+		if verify {
+			_, err = w.VerifyAndUpdateVersion(context.Background(), PinnedWorkspaceVersion(&SemanticVersion{Versions: []int{0, 12, 25}}), time.Second)
+		} else {
+			err = w.UpdateVersion(context.Background(), &SemanticVersion{Versions: []int{0, 12, 25}})
+		}
+		if _, ok := err.(*ScheduleError); !ok {
+			t.Errorf("Failed: verify = %t / want ScheduleError / got = %v", verify, err)
+		}
+		if len(client.updated) != 0 {
+			t.Errorf("Failed: verify = %t / want no update / got = %v", verify, client.updated)
+		}
+	}
+}
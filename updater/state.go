@@ -0,0 +1,42 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+)
+
+// DowngradeError is returned when the version is older than the one which wrote the current state
+type DowngradeError struct {
+	Version      *SemanticVersion
+	StateVersion *SemanticVersion
+}
+
+func (e *DowngradeError) Error() string {
+	return fmt.Sprintf("Version %s is older than %s which wrote the current state", e.Version, e.StateVersion)
+}
+
+// SetAllowDowngrade sets whether to allow the version older than the one which wrote the current state
+func (w *Workspace) SetAllowDowngrade(allow bool) {
+	w.allowDowngrade = allow
+}
+
+// GetStateVersion get terraform version which wrote the current state. It returns nil if the workspace has no state.
+func (w *Workspace) GetStateVersion(ctx context.Context) (*SemanticVersion, error) {
+	return w.client.ReadStateVersion(ctx, w.organization, w.workspace)
+}
+
+// checkDowngrade returns DowngradeError if the version can't read the current state
+func (w *Workspace) checkDowngrade(ctx context.Context, s *SemanticVersion) error {
+	if w.allowDowngrade {
+		return nil
+	}
+
+	stateVersion, err := w.GetStateVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if stateVersion != nil && s.Compare(stateVersion) < 0 {
+		return &DowngradeError{Version: s, StateVersion: stateVersion}
+	}
+	return nil
+}
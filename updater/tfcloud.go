@@ -2,43 +2,109 @@ package updater
 
 import (
 	"context"
-	"strconv"
-	"strings"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
 
 	tfe "github.com/hashicorp/go-tfe"
 )
 
 // TfCloud represents Terraform Cloud API wrapper
 type TfCloud interface {
-	ReadWorkspaceVersion(org, workspace string) (*SemanticVersion, error)
-	UpdateWorkspaceVersion(org, workspace string, sv *SemanticVersion) error
+	ReadWorkspaceVersion(ctx context.Context, org, workspace string) (*WorkspaceVersion, error)
+	UpdateWorkspaceVersion(ctx context.Context, org, workspace string, v *WorkspaceVersion) error
+	CreateRun(ctx context.Context, org, workspace string, options *RunOptions) (*Run, error)
+	ReadRun(ctx context.Context, runID string) (*Run, error)
+	CancelRun(ctx context.Context, runID string) error
+	ReadLatestRun(ctx context.Context, org, workspace string) (*Run, error)
+	ReadWorkspaceStatus(ctx context.Context, org, workspace string) (*WorkspaceStatus, error)
+	LockWorkspace(ctx context.Context, org, workspace, reason string) error
+	UnlockWorkspace(ctx context.Context, org, workspace string) error
+	ReadStateVersion(ctx context.Context, org, workspace string) (*SemanticVersion, error)
+	ListWorkspaces(ctx context.Context, org, project string) ([]string, error)
+	ListTaggedWorkspaces(ctx context.Context, org, tag string) ([]string, error)
+	ReadWorkspaceScope(ctx context.Context, org, workspace string) (*WorkspaceScope, error)
 }
 
 type tfcloudImpl struct {
 	*tfe.Client
-	ctx context.Context
+	address    string
+	token      string
+	httpClient *http.Client
 }
 
-// NewTfCloud creates a new TfCloud interface
-func NewTfCloud(address, token string) (TfCloud, error) {
+// NewTfCloud creates a new TfCloud interface.
+// httpClient is used for all API calls, and http.DefaultClient is used if it is nil.
+// go-tfe pings the API without a context on creation, so the creation is abandoned when ctx is done.
+func NewTfCloud(ctx context.Context, address, token string, httpClient *http.Client) (TfCloud, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	// go-tfe retries 429 up to 30 times by itself, so it gets an error instead and the retries are left to httpClient
+	tfeClient := *httpClient
+	tfeClient.Transport = &rateLimitTransport{base: httpClient.Transport}
 	config := &tfe.Config{
-		Token: token,
+		Address:    tfe.DefaultAddress,
+		Token:      token,
+		HTTPClient: &tfeClient,
+	}
+	if address != "" {
+		config.Address = "https://" + address
 	}
 
-	client, err := tfe.NewClient(config)
-	if err != nil {
-		return nil, err
+	type result struct {
+		client *tfe.Client
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		client, err := tfe.NewClient(config)
+		ch <- result{client, err}
+	}()
+
+	var client *tfe.Client
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			return nil, r.err
+		}
+		client = r.client
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 
-	ctx := context.Background()
 	return &tfcloudImpl{
-		client,
-		ctx,
+		Client:     client,
+		address:    config.Address,
+		token:      token,
+		httpClient: httpClient,
 	}, nil
 }
 
-func (t *tfcloudImpl) readWorkspace(organization, workspace string) (*tfe.Workspace, error) {
-	ws, err := t.Workspaces.Read(t.ctx, organization, workspace)
+// rateLimitTransport turns 429 responses into errors, which go-tfe doesn't retry
+type rateLimitTransport struct {
+	base http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return nil, fmt.Errorf("Rate limited by %s: %s", req.URL.Host, resp.Status)
+}
+
+func (t *tfcloudImpl) readWorkspace(ctx context.Context, organization, workspace string) (*tfe.Workspace, error) {
+	ws, err := t.Workspaces.Read(ctx, organization, workspace)
 	if err != nil {
 		return nil, err
 	}
@@ -46,36 +112,187 @@ func (t *tfcloudImpl) readWorkspace(organization, workspace string) (*tfe.Worksp
 }
 
 // ReadWorkspaceVersion reads Terraform Cloud workspace terraform version
-func (t *tfcloudImpl) ReadWorkspaceVersion(org, workspace string) (*SemanticVersion, error) {
-	ws, err := t.Workspaces.Read(t.ctx, org, workspace)
+func (t *tfcloudImpl) ReadWorkspaceVersion(ctx context.Context, org, workspace string) (*WorkspaceVersion, error) {
+	ws, err := t.Workspaces.Read(ctx, org, workspace)
 	if err != nil {
 		return nil, err
 	}
 
-	sv := make([]int, 3)
-	for i, v := range strings.Split(ws.TerraformVersion, ".") {
-		sv[i], _ = strconv.Atoi(v)
-	}
-
-	return &SemanticVersion{Versions: sv}, nil
+	return NewWorkspaceVersion(ws.TerraformVersion)
 }
 
 // UpdateWorkspaceVersion updates Terraform Cloud workspace terraform version
-func (t *tfcloudImpl) UpdateWorkspaceVersion(org, workspace string, sv *SemanticVersion) error {
-	oldWs, err := t.readWorkspace(org, workspace)
+func (t *tfcloudImpl) UpdateWorkspaceVersion(ctx context.Context, org, workspace string, v *WorkspaceVersion) error {
+	oldWs, err := t.readWorkspace(ctx, org, workspace)
 	if err != nil {
 		return err
 	}
 
-	if oldWs.TerraformVersion == sv.String() {
+	if oldWs.TerraformVersion == v.String() {
 		return nil
 	}
 
 	options := tfe.WorkspaceUpdateOptions{
-		TerraformVersion: tfe.String(sv.String()),
+		TerraformVersion: tfe.String(v.String()),
 	}
-	if _, err = t.Client.Workspaces.Update(t.ctx, org, workspace, options); err != nil {
+	if _, err = t.Client.Workspaces.Update(ctx, org, workspace, options); err != nil {
 		return err
 	}
 	return nil
 }
+
+// CreateRun creates a new run on the workspace.
+// Plan-only runs are created through the API directly, because go-tfe doesn't support them.
+func (t *tfcloudImpl) CreateRun(ctx context.Context, org, workspace string, options *RunOptions) (*Run, error) {
+	ws, err := t.readWorkspace(ctx, org, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	if !options.PlanOnly {
+		r, err := t.Runs.Create(ctx, tfe.RunCreateOptions{
+			Message:   tfe.String(options.Message),
+			Workspace: ws,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return newRun(r), nil
+	}
+
+	in := &apiDocument{
+		Data: &apiResource{
+			Type: "runs",
+			Attributes: map[string]interface{}{
+				"message":   options.Message,
+				"plan-only": true,
+			},
+			Relationships: map[string]apiRelationship{
+				"workspace": {Data: &apiResource{Type: "workspaces", ID: ws.ID}},
+			},
+		},
+	}
+	if options.TerraformVersion != "" {
+		in.Data.Attributes["terraform-version"] = options.TerraformVersion
+	}
+	var out apiDocument
+	if err := t.apiRequest(ctx, http.MethodPost, "runs", in, &out); err != nil {
+		return nil, err
+	}
+	return &Run{ID: out.Data.ID, Status: out.Data.stringAttribute("status"), PlanOnly: true}, nil
+}
+
+// CancelRun cancels the run which is pending or running
+func (t *tfcloudImpl) CancelRun(ctx context.Context, runID string) error {
+	return t.Runs.Cancel(ctx, runID, tfe.RunCancelOptions{Comment: tfe.String("Canceled by terraform-cloud-updater")})
+}
+
+// ReadRun reads the run status
+func (t *tfcloudImpl) ReadRun(ctx context.Context, runID string) (*Run, error) {
+	r, err := t.Runs.Read(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	return newRun(r), nil
+}
+
+func newRun(r *tfe.Run) *Run {
+	run := &Run{ID: r.ID, Status: string(r.Status)}
+	if r.Actions != nil {
+		run.Confirmable = r.Actions.IsConfirmable
+	}
+	return run
+}
+
+// ReadLatestRun reads the latest run which is not plan-only, or nil if there is no such run.
+// go-tfe doesn't support the terraform-version and status-timestamps attributes, so the API is called directly.
+func (t *tfcloudImpl) ReadLatestRun(ctx context.Context, org, workspace string) (*Run, error) {
+	ws, err := t.readWorkspace(ctx, org, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	// runs are listed from the newest, and plan-only runs are rarely more than a few in a row
+	var out apiListDocument
+	if err := t.apiRequest(ctx, http.MethodGet, fmt.Sprintf("workspaces/%s/runs?%s", ws.ID, url.Values{"page[size]": {"20"}}.Encode()), nil, &out); err != nil {
+		return nil, err
+	}
+	for _, r := range out.Data {
+		if planOnly, _ := r.Attributes["plan-only"].(bool); planOnly {
+			continue
+		}
+		run := &Run{ID: r.ID, Status: r.stringAttribute("status"), TerraformVersion: r.stringAttribute("terraform-version")}
+		if actions, ok := r.Attributes["actions"].(map[string]interface{}); ok {
+			run.Confirmable, _ = actions["is-confirmable"].(bool)
+		}
+		if timestamps, ok := r.Attributes["status-timestamps"].(map[string]interface{}); ok {
+			for _, key := range []string{"applied-at", "planned-and-finished-at"} {
+				if s, ok := timestamps[key].(string); ok {
+					run.FinishedAt, _ = time.Parse(time.RFC3339, s)
+					break
+				}
+			}
+		}
+		return run, nil
+	}
+	return nil, nil
+}
+
+// ReadWorkspaceStatus reads the workspace lock state and the current run status
+func (t *tfcloudImpl) ReadWorkspaceStatus(ctx context.Context, org, workspace string) (*WorkspaceStatus, error) {
+	ws, err := t.readWorkspace(ctx, org, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &WorkspaceStatus{Locked: ws.Locked}
+	if ws.CurrentRun != nil && ws.CurrentRun.ID != "" {
+		if status.CurrentRun, err = t.ReadRun(ctx, ws.CurrentRun.ID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// LockWorkspace locks the workspace
+func (t *tfcloudImpl) LockWorkspace(ctx context.Context, org, workspace, reason string) error {
+	ws, err := t.readWorkspace(ctx, org, workspace)
+	if err != nil {
+		return err
+	}
+	_, err = t.Workspaces.Lock(ctx, ws.ID, tfe.WorkspaceLockOptions{Reason: tfe.String(reason)})
+	return err
+}
+
+// UnlockWorkspace unlocks the workspace
+func (t *tfcloudImpl) UnlockWorkspace(ctx context.Context, org, workspace string) error {
+	ws, err := t.readWorkspace(ctx, org, workspace)
+	if err != nil {
+		return err
+	}
+	_, err = t.Workspaces.Unlock(ctx, ws.ID)
+	return err
+}
+
+// ReadStateVersion reads terraform version which wrote the current state version, or nil if there is no state.
+// go-tfe doesn't support the terraform-version attribute, so the API is called directly.
+func (t *tfcloudImpl) ReadStateVersion(ctx context.Context, org, workspace string) (*SemanticVersion, error) {
+	ws, err := t.readWorkspace(ctx, org, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	var out apiDocument
+	err = t.apiRequest(ctx, http.MethodGet, fmt.Sprintf("workspaces/%s/current-state-version", ws.ID), nil, &out)
+	if err == tfe.ErrResourceNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	v := out.Data.stringAttribute("terraform-version")
+	if v == "" {
+		return nil, nil
+	}
+	return NewSemanticVersion(v)
+}
@@ -0,0 +1,57 @@
+package updater
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewTfCloudContext(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := NewTfCloud(ctx, strings.TrimPrefix(ts.URL, "https://"), "token", ts.Client())
+	if err != context.DeadlineExceeded {
+		t.Errorf("Failed: want = %v / got = %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestTfCloudRateLimit(t *testing.T) {
+	var requests int32
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/ping") {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	transport := NewRetryTransport(3)
+	transport.Base = ts.Client().Transport
+	transport.MinBackoff = time.Millisecond
+	client, err := NewTfCloud(context.Background(), strings.TrimPrefix(ts.URL, "https://"), "token", &http.Client{Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// go-tfe doesn't retry on top of RetryTransport
+	if _, err := client.ReadWorkspaceVersion(context.Background(), "chroju", "network"); err == nil {
+		t.Errorf("Failed: want = rate limit error / got = nil")
+	}
+	if requests != 3 {
+		t.Errorf("Failed: want requests = 3 / got = %d", requests)
+	}
+}
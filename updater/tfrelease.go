@@ -1,49 +1,198 @@
 package updater
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	tfReleaseURL = "https://api.github.com/repos/hashicorp/terraform/releases"
+	// tfReleasePageSize is the max page size of the GitHub API
+	tfReleasePageSize = 100
+	// tfReleaseMaxPages stops following the pages, in case the Link header loops
+	tfReleaseMaxPages = 100
 )
 
 // TfRelease represents Terraform release
 type TfRelease struct {
-	Draft           bool   `json:"draft"`
-	Tag             string `json:"tag_name"`
-	SemanticVersion *SemanticVersion
+	Draft           bool             `json:"draft"`
+	Tag             string           `json:"tag_name"`
+	PublishedAt     time.Time        `json:"published_at"`
+	SemanticVersion *SemanticVersion `json:"-"`
 }
 
 // TfReleases is interface to list up Terraform releases
 type TfReleases interface {
-	List() ([]*TfRelease, error)
+	List(ctx context.Context) ([]*TfRelease, error)
 }
 
-type tfReleasesImpl struct{}
+type tfReleasesImpl struct {
+	httpClient *http.Client
+	url        string
+	cache      *ReleaseCache
 
-// NewTfReleases creates new TfReleases
-func NewTfReleases() TfReleases {
-	return &tfReleasesImpl{}
+	mu       sync.Mutex
+	releases []*TfRelease
+}
+
+// NewTfReleases creates new TfReleases.
+// http.DefaultClient is used if httpClient is nil.
+// The releases are kept in memory during the process, and also in cache if it is not nil.
+func NewTfReleases(httpClient *http.Client, cache *ReleaseCache) TfReleases {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &tfReleasesImpl{httpClient: httpClient, url: tfReleaseURL, cache: cache}
 }
 
 // List returns Terraform releases
-func (t *tfReleasesImpl) List() ([]*TfRelease, error) {
-	resp, err := http.Get(tfReleaseURL)
+func (t *tfReleasesImpl) List(ctx context.Context) ([]*TfRelease, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.releases != nil {
+		return t.releases, nil
+	}
+
+	body, err := t.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err := parseTfReleases(body)
+	if err != nil {
+		return nil, err
+	}
+	t.releases = releases
+	return releases, nil
+}
+
+// fetch returns the release list of all the pages in a JSON array.
+// The cached list is used while it is fresh, and revalidated with the ETag of the first page after that.
+func (t *tfReleasesImpl) fetch(ctx context.Context) ([]byte, error) {
+	var cached *releaseCacheEntry
+	if t.cache != nil {
+		cached = t.cache.load(t.url)
+		if cached != nil && cached.isFresh(t.cache.ttl, time.Now()) {
+			return cached.Body, nil
+		}
+	}
+
+	sep := "?"
+	if strings.Contains(t.url, "?") {
+		sep = "&"
+	}
+	next := fmt.Sprintf("%s%sper_page=%d", t.url, sep, tfReleasePageSize)
+
+	var etag string
+	var releases []json.RawMessage
+	for page := 0; next != ""; page++ {
+		if page == tfReleaseMaxPages {
+			return nil, fmt.Errorf("failed to list Terraform releases: more than %d pages", tfReleaseMaxPages)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+		if page == 0 && cached != nil && cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+
+		p, err := t.fetchPage(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if p.notModified {
+			cached.FetchedAt = time.Now()
+			// failing to refresh the cache must not fail the command
+			_ = t.cache.save(cached)
+			return cached.Body, nil
+		}
+		if page == 0 {
+			etag = p.etag
+		}
+		releases = append(releases, p.items...)
+		next = p.next
+	}
+
+	body, err := json.Marshal(releases)
+	if err != nil {
+		return nil, err
+	}
+	if t.cache != nil {
+		_ = t.cache.save(&releaseCacheEntry{
+			URL:       t.url,
+			ETag:      etag,
+			FetchedAt: time.Now(),
+			Body:      body,
+		})
+	}
+	return body, nil
+}
+
+// releasePage is a page of the release list
+type releasePage struct {
+	items []json.RawMessage
+	// next is the URL of the next page, or empty on the last page
+	next        string
+	etag        string
+	notModified bool
+}
+
+// fetchPage reads a page of the release list.
+// 304 Not Modified is returned only for the request with If-None-Match.
+func (t *tfReleasesImpl) fetchPage(ctx context.Context, req *http.Request) (*releasePage, error) {
+	resp, err := t.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	switch {
+	case resp.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != "":
+		return &releasePage{notModified: true}, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("failed to list Terraform releases: %s", resp.Status)
+	}
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
+	p := &releasePage{next: nextPageLink(resp.Header.Get("Link")), etag: resp.Header.Get("ETag")}
+	if err = json.Unmarshal(body, &p.items); err != nil {
+		return nil, fmt.Errorf("failed to list Terraform releases: %s", err)
+	}
+	return p, nil
+}
 
+// nextPageLink returns the URL of rel="next" in the Link header, like `<https://...?page=2>; rel="next", <...>; rel="last"`
+func nextPageLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+func parseTfReleases(body []byte) ([]*TfRelease, error) {
 	var tfReleases []*TfRelease
-	if err = json.Unmarshal(body, &tfReleases); err != nil {
+	if err := json.Unmarshal(body, &tfReleases); err != nil {
 		return nil, err
 	}
 	for _, v := range tfReleases {
@@ -55,3 +204,113 @@ func (t *tfReleasesImpl) List() ([]*TfRelease, error) {
 	}
 	return tfReleases, nil
 }
+
+// greatestRelease returns the greatest version of the releases which match, excluding drafts.
+// The releases are listed by the release date, and patches of old versions can be released after new ones,
+// so the first match is not always the greatest. nil is returned if no release matches.
+func greatestRelease(releases []*TfRelease, match func(*TfRelease) bool) *SemanticVersion {
+	var greatest *SemanticVersion
+	for _, v := range releases {
+		if v.Draft || !match(v) {
+			continue
+		}
+		if greatest == nil || v.SemanticVersion.Compare(greatest) > 0 {
+			greatest = v.SemanticVersion
+		}
+	}
+	return greatest
+}
+
+// isStableRelease returns whether the release is not a pre-release
+func isStableRelease(r *TfRelease) bool {
+	return r.SemanticVersion.Status == ""
+}
+
+type fileTfReleases struct {
+	path string
+}
+
+// NewFileTfReleases creates new TfReleases which reads releases from the local JSON file,
+// in the same schema as the GitHub releases API and the export-releases command.
+func NewFileTfReleases(path string) TfReleases {
+	return &fileTfReleases{path: path}
+}
+
+// List returns Terraform releases in the file
+func (t *fileTfReleases) List(ctx context.Context) ([]*TfRelease, error) {
+	body, err := ioutil.ReadFile(t.path)
+	if err != nil {
+		return nil, err
+	}
+	releases, err := parseTfReleases(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", t.path, err)
+	}
+	return releases, nil
+}
+
+type cachedTfReleases struct {
+	cache *ReleaseCache
+}
+
+// NewCachedTfReleases creates new TfReleases which only reads the cache, even if it is expired
+func NewCachedTfReleases(cache *ReleaseCache) TfReleases {
+	return &cachedTfReleases{cache: cache}
+}
+
+// List returns Terraform releases in the cache
+func (t *cachedTfReleases) List(ctx context.Context) ([]*TfRelease, error) {
+	cached := t.cache.load(tfReleaseURL)
+	if cached == nil {
+		return nil, fmt.Errorf("no cached Terraform releases in %s", t.cache.path)
+	}
+	return parseTfReleases(cached.Body)
+}
+
+type announcedTfReleases struct {
+	source    TfReleases
+	announced []*TfRelease
+}
+
+// NewAnnouncedTfReleases creates new TfReleases which adds the announced releases to the ones of the source,
+// so that the versions announced by the webhook are used before the source lists them.
+// The announced releases are put before the older versions, and the ones the source already lists are ignored.
+func NewAnnouncedTfReleases(source TfReleases, announced []*TfRelease) TfReleases {
+	return &announcedTfReleases{source: source, announced: announced}
+}
+
+// List returns Terraform releases of the source with the announced releases
+func (t *announcedTfReleases) List(ctx context.Context) ([]*TfRelease, error) {
+	listed, err := t.source.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the source may keep the releases in memory, so they are copied before the insertion
+	releases := make([]*TfRelease, len(listed))
+	copy(releases, listed)
+	for _, a := range t.announced {
+		i, found := 0, false
+		for ; i < len(releases); i++ {
+			c := releases[i].SemanticVersion.Compare(a.SemanticVersion)
+			if found = c == 0; found || c < 0 {
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		releases = append(releases[:i], append([]*TfRelease{a}, releases[i:]...)...)
+	}
+	return releases, nil
+}
+
+// WriteTfReleases writes releases in JSON, which can be read by NewFileTfReleases
+func WriteTfReleases(w io.Writer, releases []*TfRelease) error {
+	b, err := json.MarshalIndent(releases, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,186 @@
+package updater
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is the default number of attempts of each API call
+	DefaultMaxAttempts = 5
+
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// RetryTransport is http.RoundTripper which retries transient errors with exponential backoff and jitter.
+// Idempotent requests are retried on network errors and 5xx responses,
+// and all requests are retried when rate limited, because the server didn't process them.
+type RetryTransport struct {
+	Base        http.RoundTripper
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewRetryTransport creates a new RetryTransport with the default backoff
+func NewRetryTransport(maxAttempts int) *RetryTransport {
+	return &RetryTransport{
+		Base:        http.DefaultTransport,
+		MaxAttempts: maxAttempts,
+		MinBackoff:  defaultMinBackoff,
+		MaxBackoff:  defaultMaxBackoff,
+	}
+}
+
+// NewHTTPClient creates a new http.Client which retries with RetryTransport
+func NewHTTPClient(maxAttempts int) *http.Client {
+	return &http.Client{Transport: NewRetryTransport(maxAttempts)}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// the body can't be sent again without GetBody
+	maxAttempts := t.MaxAttempts
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		resp, err := base.RoundTrip(r)
+		if attempt >= maxAttempts || !t.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		// give up at once when the wait doesn't end before the deadline, instead of failing in the middle of it
+		wait := t.backoff(attempt, resp)
+		if deadline, ok := req.Context().Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *RetryTransport) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return isIdempotent(req.Method)
+	}
+	if isRateLimited(resp) {
+		return true
+	}
+	return resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented && isIdempotent(req.Method)
+}
+
+// backoff returns the time to wait before the next attempt.
+// The server's Retry-After or X-RateLimit-Reset takes precedence over the exponential backoff,
+// and it is capped at MaxBackoff, because GitHub's reset can be an hour later.
+func (t *RetryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := retryAfter(resp.Header, time.Now()); ok {
+			if wait > t.MaxBackoff {
+				wait = t.MaxBackoff
+			}
+			return wait + t.jitter(t.MinBackoff)
+		}
+	}
+
+	wait := t.MinBackoff << uint(attempt-1)
+	if wait <= 0 || wait > t.MaxBackoff {
+		wait = t.MaxBackoff
+	}
+	// full jitter in the upper half, so that concurrent clients don't retry at once
+	return wait/2 + t.jitter(wait/2)
+}
+
+func (t *RetryTransport) jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rnd == nil {
+		t.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return time.Duration(t.rnd.Int63n(int64(max)))
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRateLimited returns true for 429, and GitHub's 403 with no remaining rate limit
+func isRateLimited(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0"
+}
+
+// retryAfter parses Retry-After (seconds or HTTP date) and X-RateLimit-Reset.
+// X-RateLimit-Reset is seconds to wait in Terraform Cloud, and the epoch time of the reset in GitHub.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	if v := h.Get("Retry-After"); v != "" {
+		if sec, err := strconv.Atoi(v); err == nil && sec >= 0 {
+			return time.Duration(sec) * time.Second, true
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return nonNegative(at.Sub(now)), true
+		}
+	}
+
+	if v := h.Get("X-RateLimit-Reset"); v != "" {
+		reset, err := strconv.ParseFloat(v, 64)
+		if err != nil || reset < 0 {
+			return 0, false
+		}
+		// values like 1600000000 can't be a wait time, so they are the epoch time
+		if reset > 1e9 {
+			return nonNegative(time.Unix(int64(reset), 0).Sub(now)), true
+		}
+		return time.Duration(reset * float64(time.Second)), true
+	}
+	return 0, false
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,212 @@
+package updater
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	cases := []struct {
+		method       string
+		failures     int
+		failStatus   int
+		header       map[string]string
+		maxAttempts  int
+		wantStatus   int
+		wantRequests int32
+	}{
+		{
+			method:       http.MethodGet,
+			failures:     2,
+			failStatus:   http.StatusServiceUnavailable,
+			maxAttempts:  5,
+			wantStatus:   http.StatusOK,
+			wantRequests: 3,
+		},
+		{
+			method:       http.MethodGet,
+			failures:     10,
+			failStatus:   http.StatusBadGateway,
+			maxAttempts:  3,
+			wantStatus:   http.StatusBadGateway,
+			wantRequests: 3,
+		},
+		{
+			method:       http.MethodPost,
+			failures:     2,
+			failStatus:   http.StatusServiceUnavailable,
+			maxAttempts:  5,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantRequests: 1,
+		},
+		{
+			method:       http.MethodPost,
+			failures:     2,
+			failStatus:   http.StatusTooManyRequests,
+			header:       map[string]string{"Retry-After": "0"},
+			maxAttempts:  5,
+			wantStatus:   http.StatusOK,
+			wantRequests: 3,
+		},
+		{
+			method:       http.MethodPatch,
+			failures:     1,
+			failStatus:   http.StatusTooManyRequests,
+			header:       map[string]string{"X-RateLimit-Reset": "0.01"},
+			maxAttempts:  5,
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+		{
+			method:       http.MethodGet,
+			failures:     1,
+			failStatus:   http.StatusForbidden,
+			header:       map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "0"},
+			maxAttempts:  5,
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+		{
+			method:       http.MethodGet,
+			failures:     1,
+			failStatus:   http.StatusTooManyRequests,
+			header:       map[string]string{"Retry-After": "3600"},
+			maxAttempts:  5,
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+		{
+			method:       http.MethodGet,
+			failures:     1,
+			failStatus:   http.StatusNotFound,
+			maxAttempts:  5,
+			wantStatus:   http.StatusNotFound,
+			wantRequests: 1,
+		},
+	}
+
+	for _, v := range cases {
+		var requests int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&requests, 1)
+			if r.Method == http.MethodPost || r.Method == http.MethodPatch {
+				body, _ := ioutil.ReadAll(r.Body)
+				if string(body) != "body" {
+					t.Errorf("Failed: method = %s / want body = body / got = %s", v.method, body)
+				}
+			}
+			if int(n) <= v.failures {
+				for key, value := range v.header {
+					w.Header().Set(key, value)
+				}
+				w.WriteHeader(v.failStatus)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		transport := NewRetryTransport(v.maxAttempts)
+		transport.MinBackoff = time.Millisecond
+		transport.MaxBackoff = 5 * time.Millisecond
+		client := &http.Client{Transport: transport}
+
+		req, _ := http.NewRequest(v.method, ts.URL, strings.NewReader("body"))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Failed of error: %s / method = %s / status = %d", err, v.method, v.failStatus)
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode != v.wantStatus {
+				t.Errorf("Failed: method = %s / status = %d / want = %d / got = %d", v.method, v.failStatus, v.wantStatus, resp.StatusCode)
+			}
+		}
+		if requests != v.wantRequests {
+			t.Errorf("Failed: method = %s / status = %d / want requests = %d / got = %d", v.method, v.failStatus, v.wantRequests, requests)
+		}
+		ts.Close()
+	}
+}
+
+func TestRetryTransportDeadline(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	start := time.Now()
+	resp, err := NewHTTPClient(5).Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || requests != 1 {
+		t.Errorf("Failed: want = 429 / 1 request / got = %d / %d requests", resp.StatusCode, requests)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Failed: want no wait / got = %s", elapsed)
+	}
+}
+
+func TestTfReleasesRetry(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`[{"draft": false, "tag_name": "v0.13.0"}]`))
+	}))
+	defer ts.Close()
+
+	transport := NewRetryTransport(3)
+	transport.MinBackoff = time.Millisecond
+	releases := &tfReleasesImpl{httpClient: &http.Client{Transport: transport}, url: ts.URL}
+
+	got, err := releases.List(context.Background())
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if len(got) != 1 || got[0].SemanticVersion.String() != "0.13.0" {
+		t.Errorf("Failed: want = [0.13.0] / got = %v", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		header   map[string]string
+		expected time.Duration
+		ok       bool
+	}{
+		{map[string]string{"Retry-After": "3"}, 3 * time.Second, true},
+		{map[string]string{"Retry-After": "Sat, 01 Aug 2020 00:00:10 GMT"}, 10 * time.Second, true},
+		{map[string]string{"X-RateLimit-Reset": "0.5"}, 500 * time.Millisecond, true},
+		{map[string]string{"X-RateLimit-Reset": "1596240020"}, 20 * time.Second, true},
+		{map[string]string{"X-RateLimit-Reset": "1596239000"}, 0, true},
+		{map[string]string{"Retry-After": "2", "X-RateLimit-Reset": "10"}, 2 * time.Second, true},
+		{map[string]string{}, 0, false},
+	}
+
+	for _, v := range cases {
+		h := http.Header{}
+		for key, value := range v.header {
+			h.Set(key, value)
+		}
+		got, ok := retryAfter(h, now)
+		if got != v.expected || ok != v.ok {
+			t.Errorf("Failed: header = %v / want = %s, %t / got = %s, %t", v.header, v.expected, v.ok, got, ok)
+		}
+	}
+}
@@ -27,20 +27,146 @@ func (s *SemanticVersion) String() string {
 	return strings.Join(stringsVar, ".") + status
 }
 
-// NewSemanticVersion creates a new SemanticVersion from the string represents semantic version
+// Compare returns -1, 0 or 1 when the version is less than, equal to or greater than the target.
+// Missing parts are regarded as 0, and a version with status like "beta" is less than the one without status.
+// Statuses are compared by comparePrerelease.
+func (s *SemanticVersion) Compare(target *SemanticVersion) int {
+	for i := 0; i < len(s.Versions) || i < len(target.Versions); i++ {
+		var a, b int
+		if i < len(s.Versions) {
+			a = s.Versions[i]
+		}
+		if i < len(target.Versions) {
+			b = target.Versions[i]
+		}
+		if a < b {
+			return -1
+		}
+		if a > b {
+			return 1
+		}
+	}
+
+	switch {
+	case s.Status == target.Status:
+		return 0
+	case s.Status == "":
+		return 1
+	case target.Status == "":
+		return -1
+	}
+	return comparePrerelease(s.Status, target.Status)
+}
+
+// comparePrerelease compares the pre-release statuses in the semantic versioning precedence.
+// The dot separated identifiers are compared from the left, and numeric ones are compared numerically and lower than the others.
+// Terraform uses identifiers like "rc10", so the numbers in an identifier are also compared numerically, and "rc9" < "rc10".
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareIdentifier(splitDigits(as[i]), splitDigits(bs[i])); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifier compares the identifiers split by splitDigits
+func compareIdentifier(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		an, aErr := strconv.Atoi(a[i])
+		bn, bErr := strconv.Atoi(b[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case a[i] != b[i]:
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+// splitDigits splits the identifier into the runs of digits and the others, like "rc10" into ["rc", "10"]
+func splitDigits(s string) []string {
+	var parts []string
+	start := 0
+	for i := 1; i <= len(s); i++ {
+		if i == len(s) || isDigit(s[i]) != isDigit(s[i-1]) {
+			parts = append(parts, s[start:i])
+			start = i
+		}
+	}
+	return parts
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// VersionParseError is the error for the string which can't be parsed as a version
+type VersionParseError struct {
+	Raw    string
+	Reason string
+}
+
+func (e *VersionParseError) Error() string {
+	return fmt.Sprintf("%q is not valid version: %s", e.Raw, e.Reason)
+}
+
+// NewSemanticVersion creates a new SemanticVersion from the string represents semantic version,
+// like "0.12.0", "v0.13.0" or "1.1.0-rc2". It returns *VersionParseError if the string is not valid,
+// including the one without exactly three numbers like "1" or "1.2.3.4".
 func NewSemanticVersion(versionString string) (*SemanticVersion, error) {
+	return parseSemanticVersion(versionString, false)
+}
+
+// parseSemanticVersion parses the version. Constraints like "~> 0.12" may omit the minor and patch numbers when partial is true.
+func parseSemanticVersion(versionString string, partial bool) (*SemanticVersion, error) {
 	var status string
-	versionAndStatus := strings.Split(versionString, "-")
+	versionAndStatus := strings.SplitN(strings.TrimPrefix(versionString, "v"), "-", 2)
 	if len(versionAndStatus) > 1 {
 		status = versionAndStatus[1]
+		if status == "" || strings.TrimLeft(status, "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-") != "" {
+			return nil, &VersionParseError{Raw: versionString, Reason: fmt.Sprintf("invalid pre-release %q", status)}
+		}
 	}
 
 	split := strings.Split(versionAndStatus[0], ".")
+	if len(split) > 3 || (!partial && len(split) != 3) {
+		return nil, &VersionParseError{Raw: versionString, Reason: fmt.Sprintf("%d numbers instead of major.minor.patch", len(split))}
+	}
 	sv := make([]int, len(split))
 	for i, v := range split {
-		converted, err := strconv.Atoi(strings.TrimLeft(v, "v"))
+		if v == "" || strings.TrimLeft(v, "0123456789") != "" {
+			return nil, &VersionParseError{Raw: versionString, Reason: fmt.Sprintf("invalid number %q", v)}
+		}
+		converted, err := strconv.Atoi(v)
 		if err != nil {
-			return nil, err
+			return nil, &VersionParseError{Raw: versionString, Reason: fmt.Sprintf("invalid number %q", v)}
 		}
 		sv[i] = converted
 	}
@@ -52,6 +178,8 @@ func NewSemanticVersion(versionString string) (*SemanticVersion, error) {
 type RequiredVersion struct {
 	Operator        Operator
 	SemanticVersion *SemanticVersion
+	// Source is where the constraint is declared, like "main.tf:3". It is empty if unknown.
+	Source string
 }
 
 // Operator is required version operator
@@ -100,7 +228,7 @@ func NewRequiredVersions(versionString string) (RequiredVersions, error) {
 		rv.Operator = blank
 	}
 
-	sv, err := NewSemanticVersion(versionString)
+	sv, err := parseSemanticVersion(versionString, true)
 	if err != nil {
 		return nil, err
 	}
@@ -204,12 +332,7 @@ func (r *RequiredVersion) IsPessimisticConstraint(target *SemanticVersion) bool
 		return false
 	}
 	// Second, check `<`
-	nextVersion := make([]int, 2)
-	if r.SemanticVersion.Versions[1] == 9 {
-		nextVersion[1] = 0
-	} else {
-		nextVersion[1] = r.SemanticVersion.Versions[1] + 1
-	}
+	nextVersion := []int{r.SemanticVersion.Versions[0], r.SemanticVersion.Versions[1] + 1}
 	nextRv := &RequiredVersion{SemanticVersion: &SemanticVersion{Versions: nextVersion}}
 
 	if nextRv.IsGreaterThanOrEqual(target) {
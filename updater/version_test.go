@@ -50,6 +50,38 @@ func TestNewSemanticVersion(t *testing.T) {
 	}
 }
 
+func TestNewSemanticVersionInvalid(t *testing.T) {
+	var cases = []string{
+		"",
+		"latest",
+		"0.12.x",
+		"0..12",
+		"1.5.0-",
+		"1.5.0-rc1+build",
+		"0.v12.0",
+		" 0.12.0",
+		"99999999999999999999.0.0",
+		"1",
+		"0.12",
+		"1.2.3.4",
+	}
+
+	for _, v := range cases {
+		got, err := NewSemanticVersion(v)
+		parseErr, ok := err.(*VersionParseError)
+		if !ok {
+			t.Errorf("Failed: src = %q / want = VersionParseError / got = %v, %v", v, got, err)
+		} else if parseErr.Raw != v {
+			t.Errorf("Failed: src = %q / want raw = %q / got = %q", v, v, parseErr.Raw)
+		}
+	}
+
+	got, err := NewSemanticVersion("1.5.0-rc1.2")
+	if err != nil || got.String() != "1.5.0-rc1.2" {
+		t.Errorf("Failed: src = 1.5.0-rc1.2 / got = %v, %v", got, err)
+	}
+}
+
 func TestCheckVersionConsistency(t *testing.T) {
 	var cases = []struct {
 		src      string
@@ -111,6 +143,16 @@ func TestCheckVersionConsistency(t *testing.T) {
 			dst:      "0.12.5",
 			expected: true,
 		},
+		{
+			src:      "~> 1.5.0",
+			dst:      "1.5.7",
+			expected: true,
+		},
+		{
+			src:      "~> 1.5.0",
+			dst:      "1.6.0",
+			expected: false,
+		},
 	}
 	for _, v := range cases {
 		src, _ := NewRequiredVersions(v.src)
@@ -120,3 +162,33 @@ func TestCheckVersionConsistency(t *testing.T) {
 		}
 	}
 }
+
+func TestCompare(t *testing.T) {
+	var cases = []struct {
+		src      string
+		dst      string
+		expected int
+	}{
+		{src: "0.12.24", dst: "0.12.24", expected: 0},
+		{src: "0.12.20", dst: "0.12.24", expected: -1},
+		{src: "0.13.0", dst: "0.12.24", expected: 1},
+		{src: "0.12", dst: "0.12.0", expected: 0},
+		{src: "0.13.0-beta1", dst: "0.13.0", expected: -1},
+		{src: "0.13.0-rc1", dst: "0.13.0-beta3", expected: 1},
+		{src: "1.0.0-rc10", dst: "1.0.0-rc9", expected: 1},
+		{src: "1.0.0-beta2", dst: "1.0.0-beta10", expected: -1},
+		{src: "1.0.0-alpha20210811", dst: "1.0.0-alpha20210714", expected: 1},
+		{src: "1.0.0-rc1", dst: "1.0.0-rc1", expected: 0},
+		{src: "1.0.0-alpha.1", dst: "1.0.0-alpha", expected: 1},
+		{src: "1.0.0-alpha.2", dst: "1.0.0-alpha.10", expected: -1},
+		{src: "1.0.0-1", dst: "1.0.0-alpha", expected: -1},
+		{src: "1.0.0-alpha", dst: "1.0.0-beta", expected: -1},
+	}
+	for _, v := range cases {
+		src, _ := parseSemanticVersion(v.src, true)
+		dst, _ := parseSemanticVersion(v.dst, true)
+		if got := src.Compare(dst); got != v.expected {
+			t.Errorf("Failed: src = %s / dst = %s / want = %d / got = %d", v.src, v.dst, v.expected, got)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package updater
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 )
 
 // Workspace represents Terraform Cloud workspace
@@ -13,14 +15,22 @@ type Workspace struct {
 	organization     string
 	workspace        string
 	requiredVersions RequiredVersions
+	journal          Journal
+	busyPolicy       BusyPolicy
+	busyTimeout      time.Duration
+	allowDowngrade   bool
+	dryRun           bool
+	schedule         *Policy
 }
 
 // Config is Terraform Cloud workspace config
 type Config struct {
-	Organization    string
-	Workspace       string
-	RequiredVersion string
-	Hostname        string
+	Organization     string
+	Workspace        string
+	RequiredVersion  string
+	RequiredVersions RequiredVersions
+	Hostname         string
+	Releases         TfReleases
 }
 
 // NewWorkspace creates new workspace
@@ -35,16 +45,20 @@ func NewWorkspace(tfcloud TfCloud, config *Config) (*Workspace, error) {
 		hostname:         hostname,
 		organization:     config.Organization,
 		workspace:        config.Workspace,
-		requiredVersions: nil,
+		requiredVersions: config.RequiredVersions,
+		busyPolicy:       BusyAbort,
+	}
+	ws.tfRelease = config.Releases
+	if ws.tfRelease == nil {
+		ws.tfRelease = NewTfReleases(nil, nil)
 	}
-	ws.tfRelease = NewTfReleases()
 
 	if config.RequiredVersion != "" {
 		rvs, err := NewRequiredVersions(strings.TrimSpace(config.RequiredVersion))
 		if err != nil {
 			return nil, err
 		}
-		ws.requiredVersions = rvs
+		ws.requiredVersions = append(ws.requiredVersions, rvs...)
 	}
 
 	return ws, nil
@@ -55,75 +69,198 @@ func (w *Workspace) GetRequiredVersions() *RequiredVersions {
 	return &w.requiredVersions
 }
 
+// GetOrganization get the organization name
+func (w *Workspace) GetOrganization() string {
+	return w.organization
+}
+
+// GetName get the workspace name
+func (w *Workspace) GetName() string {
+	return w.workspace
+}
+
+// SetDryRun sets whether to only check the changes without applying them
+func (w *Workspace) SetDryRun(dryRun bool) {
+	w.dryRun = dryRun
+}
+
 // GetSettingsLink get workspace settings link
 func (w *Workspace) GetSettingsLink() string {
 	return fmt.Sprintf("https://%s/app/%s/workspaces/%s/settings/general", w.hostname, w.organization, w.workspace)
 }
 
-// GetCurrentVersion get terraform cloud workspace current terraform veresion
-func (w *Workspace) GetCurrentVersion() (*SemanticVersion, error) {
-	cv, err := w.client.ReadWorkspaceVersion(w.organization, w.workspace)
+// GetWorkspaceVersion get terraform version setting of the workspace, which may be "latest" or a version constraint
+func (w *Workspace) GetWorkspaceVersion(ctx context.Context) (*WorkspaceVersion, error) {
+	return w.client.ReadWorkspaceVersion(ctx, w.organization, w.workspace)
+}
+
+// GetCurrentVersion get terraform cloud workspace current terraform veresion.
+// If the workspace has "latest" or a version constraint, the version it currently resolves to is returned.
+func (w *Workspace) GetCurrentVersion(ctx context.Context) (*SemanticVersion, error) {
+	wv, err := w.GetWorkspaceVersion(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return cv, nil
+	return w.ResolveWorkspaceVersion(ctx, wv)
 }
 
-// GetLatestVersion get latest terraform version
-func (w *Workspace) GetLatestVersion() (*SemanticVersion, error) {
-	releases, err := w.tfRelease.List()
+// ResolveWorkspaceVersion returns the version which the workspace version currently resolves to
+func (w *Workspace) ResolveWorkspaceVersion(ctx context.Context, v *WorkspaceVersion) (*SemanticVersion, error) {
+	if v.IsPinned() {
+		return v.GetPinnedVersion(), nil
+	}
+
+	releases, err := w.tfRelease.List(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return v.Resolve(releases)
+}
 
-	for _, v := range releases {
-		if v.Draft {
-			continue
-		}
-		return v.SemanticVersion, nil
+// GetLatestVersion get latest terraform version, which is the greatest stable release
+func (w *Workspace) GetLatestVersion(ctx context.Context) (*SemanticVersion, error) {
+	releases, err := w.tfRelease.List(ctx)
+	if err != nil {
+		return nil, err
 	}
 
+	if v := greatestRelease(releases, isStableRelease); v != nil {
+		return v, nil
+	}
 	return nil, fmt.Errorf("Something is wrong to get latest terraform version")
 }
 
 // GetCompatibleLatestVersion get latest terraform version compatible with required versions
-func (w *Workspace) GetCompatibleLatestVersion() (*SemanticVersion, error) {
-	releases, err := w.tfRelease.List()
+func (w *Workspace) GetCompatibleLatestVersion(ctx context.Context) (*SemanticVersion, error) {
+	releases, err := w.tfRelease.List(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, v := range releases {
-		if v.Draft {
-			continue
-		}
-		if w.requiredVersions.CheckVersionConsistency(v.SemanticVersion) {
-			return v.SemanticVersion, nil
+	v := greatestRelease(releases, func(r *TfRelease) bool {
+		return isStableRelease(r) && w.requiredVersions.CheckVersionConsistency(r.SemanticVersion)
+	})
+	if v != nil {
+		return v, nil
+	}
+	return nil, fmt.Errorf("No version is compatbile with required versions '%v'", w.requiredVersions)
+}
+
+// SetJournal sets the journal to record version changes
+func (w *Workspace) SetJournal(j Journal) {
+	w.journal = j
+}
+
+// UpdateVersion update terraform cloud workspace terraform version, and pins the workspace to it
+func (w *Workspace) UpdateVersion(ctx context.Context, s *SemanticVersion) error {
+	return w.SetWorkspaceVersion(ctx, PinnedWorkspaceVersion(s))
+}
+
+// SetWorkspaceVersion sets terraform version setting of the workspace.
+// It switches the workspace between the pinned version, and "latest" or a version constraint.
+func (w *Workspace) SetWorkspaceVersion(ctx context.Context, v *WorkspaceVersion) error {
+	return w.setWorkspaceVersion(ctx, v, false)
+}
+
+// RollbackWorkspaceVersion sets terraform version setting of the workspace in the same way as SetWorkspaceVersion,
+// and records it as the rollback of the last change, so that the next rollback goes back to the change before it.
+func (w *Workspace) RollbackWorkspaceVersion(ctx context.Context, v *WorkspaceVersion) error {
+	return w.setWorkspaceVersion(ctx, v, true)
+}
+
+func (w *Workspace) setWorkspaceVersion(ctx context.Context, v *WorkspaceVersion, rollback bool) error {
+	if err := w.checkWorkspaceVersion(ctx, v); err != nil {
+		return err
+	}
+
+	var current *WorkspaceVersion
+	if w.journal != nil {
+		var err error
+		if current, err = w.GetWorkspaceVersion(ctx); err != nil {
+			return err
 		}
 	}
 
-	return nil, fmt.Errorf("No version is compatbile with required versions '%v'", w.requiredVersions)
+	err := w.whenIdle(ctx, func() error {
+		// waiting for the busy workspace may pass the end of the maintenance window
+		if err := w.CheckSchedule(ctx, w.schedule, timeNow()); err != nil {
+			return err
+		}
+		return w.client.UpdateWorkspaceVersion(ctx, w.organization, w.workspace, v)
+	})
+	if err != nil || w.dryRun {
+		return err
+	}
+	return w.recordVersionChange(current, v, rollback)
 }
 
-// UpdateVersion update terraform cloud workspace terraform version
-func (w *Workspace) UpdateVersion(s *SemanticVersion) error {
-	if !w.requiredVersions.CheckVersionConsistency(s) {
-		return fmt.Errorf("Version %v is not compatbile with required version '%v'", s, w.requiredVersions)
+// checkWorkspaceVersion checks the workspace may be changed now, and the version which the workspace version resolves to now
+// is compatible with the required versions, and is not a downgrade
+func (w *Workspace) checkWorkspaceVersion(ctx context.Context, v *WorkspaceVersion) error {
+	if err := w.CheckSchedule(ctx, w.schedule, timeNow()); err != nil {
+		return err
 	}
-	if err := w.client.UpdateWorkspaceVersion(w.organization, w.workspace, s); err != nil {
+
+	s, err := w.ResolveWorkspaceVersion(ctx, v)
+	if err != nil {
 		return err
 	}
-	return nil
+
+	if !w.requiredVersions.CheckVersionConsistency(s) {
+		if v.IsPinned() {
+			return fmt.Errorf("Version %v is not compatbile with required version '%v'", s, w.requiredVersions)
+		}
+		return fmt.Errorf("Version %v resolved from %s is not compatbile with required version '%v'", s, v, w.requiredVersions)
+	}
+	return w.checkDowngrade(ctx, s)
+}
+
+func (w *Workspace) recordVersionChange(from, to *WorkspaceVersion, rollback bool) error {
+	if w.journal == nil || from.String() == to.String() {
+		return nil
+	}
+	return w.journal.Record(&JournalEntry{
+		Time:         time.Now().UTC(),
+		Hostname:     w.hostname,
+		Organization: w.organization,
+		Workspace:    w.workspace,
+		From:         from.String(),
+		To:           to.String(),
+		Rollback:     rollback,
+	})
+}
+
+// GetPreviousVersion returns the version before the last change made by this tool which is not rolled back, and the version changed to.
+// It returns nil if no such change is recorded.
+func (w *Workspace) GetPreviousVersion() (*WorkspaceVersion, *WorkspaceVersion, error) {
+	if w.journal == nil {
+		return nil, nil, fmt.Errorf("Journal is not set")
+	}
+
+	entry, err := w.journal.Last(w.hostname, w.organization, w.workspace)
+	if err != nil || entry == nil {
+		return nil, nil, err
+	}
+
+	from, err := NewWorkspaceVersion(entry.From)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := NewWorkspaceVersion(entry.To)
+	if err != nil {
+		return nil, nil, err
+	}
+	return from, to, nil
 }
 
 // UpdateLatestVersion update terraform cloud workspace terraform to the latest version
-func (w *Workspace) UpdateCompatibleLatestVersion() (*SemanticVersion, error) {
-	newVersion, err := w.GetCompatibleLatestVersion()
+func (w *Workspace) UpdateCompatibleLatestVersion(ctx context.Context) (*SemanticVersion, error) {
+	newVersion, err := w.GetCompatibleLatestVersion(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = w.UpdateVersion(newVersion); err != nil {
+	if err = w.UpdateVersion(ctx, newVersion); err != nil {
 		return nil, err
 	}
 	return newVersion, nil
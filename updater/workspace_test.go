@@ -1,6 +1,7 @@
 package updater
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reflect"
@@ -37,10 +38,127 @@ var releases = []*TfRelease{
 
 type TfReleasesMock struct{}
 
-func (t *TfReleasesMock) List() ([]*TfRelease, error) {
+func (t *TfReleasesMock) List(ctx context.Context) ([]*TfRelease, error) {
 	return releases, nil
 }
 
+type TfCloudMock struct {
+	version *SemanticVersion
+	// workspaceVersion is set instead of version when the workspace has "latest" or a version constraint
+	workspaceVersion *WorkspaceVersion
+	runStatuses      []string
+	runs             int
+	// readRunError is returned by ReadRun instead of the run status
+	readRunError error
+	// runOptions is the options of the last created run, and runVersions is the workspace version on each poll of the run
+	runOptions  *RunOptions
+	runVersions []string
+	canceled    []string
+	statuses    []*WorkspaceStatus
+	locks       []bool
+	state       *SemanticVersion
+	projects    map[string][]string
+	scope       *WorkspaceScope
+	tags        map[string][]string
+	latestRuns  map[string]*Run
+	// failUpdates are the workspaces whose version can't be updated, and updated records the others
+	failUpdates map[string]bool
+	updated     []string
+}
+
+func (t *TfCloudMock) ReadWorkspaceVersion(ctx context.Context, org, workspace string) (*WorkspaceVersion, error) {
+	if t.workspaceVersion != nil {
+		return t.workspaceVersion, nil
+	}
+	return PinnedWorkspaceVersion(t.version), nil
+}
+
+func (t *TfCloudMock) UpdateWorkspaceVersion(ctx context.Context, org, workspace string, v *WorkspaceVersion) error {
+	if t.failUpdates[workspace] {
+		return fmt.Errorf("Workspace %s can't be updated", workspace)
+	}
+	t.updated = append(t.updated, workspace)
+	t.version = v.GetPinnedVersion()
+	t.workspaceVersion = nil
+	if !v.IsPinned() {
+		t.workspaceVersion = v
+	}
+	return nil
+}
+
+func (t *TfCloudMock) CreateRun(ctx context.Context, org, workspace string, options *RunOptions) (*Run, error) {
+	t.runs = 0
+	t.runOptions = options
+	return &Run{ID: "run-mock", Status: "pending", PlanOnly: options.PlanOnly}, nil
+}
+
+func (t *TfCloudMock) ReadRun(ctx context.Context, runID string) (*Run, error) {
+	if t.readRunError != nil {
+		return nil, t.readRunError
+	}
+	status := t.runStatuses[t.runs]
+	if t.version != nil {
+		t.runVersions = append(t.runVersions, t.version.String())
+	}
+	if t.runs < len(t.runStatuses)-1 {
+		t.runs++
+	}
+	return &Run{ID: runID, Status: status, Confirmable: status == "planned"}, nil
+}
+
+func (t *TfCloudMock) CancelRun(ctx context.Context, runID string) error {
+	t.canceled = append(t.canceled, runID)
+	return nil
+}
+
+func (t *TfCloudMock) ReadWorkspaceStatus(ctx context.Context, org, workspace string) (*WorkspaceStatus, error) {
+	if len(t.statuses) == 0 {
+		return &WorkspaceStatus{}, nil
+	}
+	status := t.statuses[0]
+	if len(t.statuses) > 1 {
+		t.statuses = t.statuses[1:]
+	}
+	return status, nil
+}
+
+func (t *TfCloudMock) LockWorkspace(ctx context.Context, org, workspace, reason string) error {
+	t.locks = append(t.locks, true)
+	return nil
+}
+
+func (t *TfCloudMock) UnlockWorkspace(ctx context.Context, org, workspace string) error {
+	t.locks = append(t.locks, false)
+	return nil
+}
+
+func (t *TfCloudMock) ReadStateVersion(ctx context.Context, org, workspace string) (*SemanticVersion, error) {
+	return t.state, nil
+}
+
+func (t *TfCloudMock) ListWorkspaces(ctx context.Context, org, project string) ([]string, error) {
+	workspaces, ok := t.projects[project]
+	if !ok {
+		return nil, fmt.Errorf("Project %s is not found in organization %s", project, org)
+	}
+	return workspaces, nil
+}
+
+func (t *TfCloudMock) ListTaggedWorkspaces(ctx context.Context, org, tag string) ([]string, error) {
+	return t.tags[tag], nil
+}
+
+func (t *TfCloudMock) ReadLatestRun(ctx context.Context, org, workspace string) (*Run, error) {
+	return t.latestRuns[workspace], nil
+}
+
+func (t *TfCloudMock) ReadWorkspaceScope(ctx context.Context, org, workspace string) (*WorkspaceScope, error) {
+	if t.scope == nil {
+		return &WorkspaceScope{}, nil
+	}
+	return t.scope, nil
+}
+
 func TestGetLatestVersion(t *testing.T) {
 	cases := []struct {
 		requiredVersions RequiredVersions
@@ -80,7 +198,7 @@ func TestGetLatestVersion(t *testing.T) {
 	}
 	for _, v := range cases {
 		w.requiredVersions = v.requiredVersions
-		result, err := w.GetLatestVersion()
+		result, err := w.GetLatestVersion(context.Background())
 		if err != nil {
 			t.Errorf("Failed: requiredVersions = %v / err = %s", v.requiredVersions, err)
 		} else if reflect.DeepEqual(result, &(v.expected)) {
@@ -128,7 +246,7 @@ func TestGetCompatibleLatestVersion(t *testing.T) {
 	}
 	for _, v := range cases {
 		w.requiredVersions = v.requiredVersions
-		result, err := w.GetLatestVersion()
+		result, err := w.GetLatestVersion(context.Background())
 		if err != nil {
 			t.Errorf("Failed: requiredVersions = %v / err = %s", v.requiredVersions, err)
 		} else if reflect.DeepEqual(result, &(v.expected)) {
@@ -137,6 +255,46 @@ func TestGetCompatibleLatestVersion(t *testing.T) {
 	}
 }
 
+func TestGetLatestVersionBackport(t *testing.T) {
+	// 0.12.30 is a backport released after 0.13.1, and 0.14.0-beta1 is a pre-release
+	list, err := parseTfReleases([]byte(`[{"tag_name": "v0.12.30"}, {"tag_name": "v0.14.0-beta1"}, {"tag_name": "v0.13.1"}, {"tag_name": "v0.13.0"}, {"tag_name": "v0.12.29"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	requiredVersions, err := NewRequiredVersions("~> 0.12.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Workspace{tfRelease: &staticTfReleases{list}, requiredVersions: requiredVersions}
+
+	latest, err := w.GetLatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if latest.String() != "0.13.1" {
+		t.Errorf("Failed: want = 0.13.1 / got = %s", latest)
+	}
+	compatible, err := w.GetCompatibleLatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if compatible.String() != "0.12.30" {
+		t.Errorf("Failed: want = 0.12.30 / got = %s", compatible)
+	}
+	// "latest" of the workspace resolves to the same version
+	wv, err := NewWorkspaceVersion("latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := wv.Resolve(list)
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if resolved.Compare(latest) != 0 {
+		t.Errorf("Failed: want = %s / got = %s", latest, resolved)
+	}
+}
+
 func TestUpdateVersion(t *testing.T) {
 	cases := []struct {
 		requiredVersions RequiredVersions
@@ -173,7 +331,7 @@ func TestUpdateVersion(t *testing.T) {
 
 	for _, v := range cases {
 		w.requiredVersions = v.requiredVersions
-		err := w.UpdateVersion(v.updateVersion)
+		err := w.UpdateVersion(context.Background(), v.updateVersion)
 		if (err != nil) != v.expectError {
 			t.Errorf("Failed: requiredVersions = %v / updateVersion = %v / want = %v", v.requiredVersions, v.updateVersion, v.expectError)
 		}
@@ -213,10 +371,10 @@ func TestUpdateCompatibleLatestVersion(t *testing.T) {
 	initialVersion := &SemanticVersion{Versions: []int{0, 12, 20}}
 
 	for _, v := range cases {
-		_ = w.UpdateVersion(initialVersion)
+		_ = w.UpdateVersion(context.Background(), initialVersion)
 
 		w.requiredVersions = v.requiredVersions
-		newVersion, err := w.UpdateCompatibleLatestVersion()
+		newVersion, err := w.UpdateCompatibleLatestVersion(context.Background())
 		if err != nil {
 			t.Errorf("Failed: %s / requiredVersions = %v /  want = %v", err.Error(), v.requiredVersions, v.expect)
 		} else if !reflect.DeepEqual(newVersion, v.expect) {
@@ -239,7 +397,7 @@ func newWorkspaceForTest() (*Workspace, error) {
 		workspace = "sample"
 	}
 
-	client, _ := NewTfCloud("app.terraform.io", token)
+	client, _ := NewTfCloud(context.Background(), "app.terraform.io", token, nil)
 	w := &Workspace{
 		client:       client,
 		tfRelease:    &TfReleasesMock{},
@@ -249,3 +407,48 @@ func newWorkspaceForTest() (*Workspace, error) {
 	}
 	return w, nil
 }
+
+func TestUpdateVersionDowngrade(t *testing.T) {
+	cases := []struct {
+		state          *SemanticVersion
+		updateVersion  *SemanticVersion
+		allowDowngrade bool
+		expectError    bool
+	}{
+		{
+			state:         nil,
+			updateVersion: &SemanticVersion{Versions: []int{0, 12, 20}},
+			expectError:   false,
+		},
+		{
+			state:         &SemanticVersion{Versions: []int{0, 12, 24}},
+			updateVersion: &SemanticVersion{Versions: []int{0, 12, 24}},
+			expectError:   false,
+		},
+		{
+			state:         &SemanticVersion{Versions: []int{0, 12, 24}},
+			updateVersion: &SemanticVersion{Versions: []int{0, 12, 20}},
+			expectError:   true,
+		},
+		{
+			state:          &SemanticVersion{Versions: []int{0, 12, 24}},
+			updateVersion:  &SemanticVersion{Versions: []int{0, 12, 20}},
+			allowDowngrade: true,
+			expectError:    false,
+		},
+	}
+
+	for _, v := range cases {
+		client := &TfCloudMock{
+			version: &SemanticVersion{Versions: []int{0, 12, 24}},
+			state:   v.state,
+		}
+		w := &Workspace{client: client}
+		w.SetAllowDowngrade(v.allowDowngrade)
+
+		err := w.UpdateVersion(context.Background(), v.updateVersion)
+		if _, ok := err.(*DowngradeError); ok != v.expectError {
+			t.Errorf("Failed: state = %v / updateVersion = %v / want downgrade error = %v / got = %v", v.state, v.updateVersion, v.expectError, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+)
+
+const latestWorkspaceVersion = "latest"
+
+// WorkspaceVersion represents terraform version setting of the workspace.
+// It is a pinned version like "0.12.29", or "latest" or a version constraint like "~> 1.5.0",
+// with which Terraform Cloud moves the workspace to the newer version automatically.
+type WorkspaceVersion struct {
+	raw        string
+	pinned     *SemanticVersion
+	constraint RequiredVersions
+}
+
+// NewWorkspaceVersion creates a new WorkspaceVersion from terraform version setting of the workspace.
+// It returns *VersionParseError with the whole setting if it is not valid.
+func NewWorkspaceVersion(versionString string) (*WorkspaceVersion, error) {
+	versionString = strings.TrimSpace(versionString)
+	if versionString == latestWorkspaceVersion {
+		return &WorkspaceVersion{raw: versionString}, nil
+	}
+
+	if strings.ContainsAny(versionString, operators+",") {
+		rvs, err := NewRequiredVersions(versionString)
+		if err != nil {
+			return nil, &VersionParseError{Raw: versionString, Reason: fmt.Sprintf("invalid version constraint: %s", err)}
+		}
+		return &WorkspaceVersion{raw: versionString, constraint: rvs}, nil
+	}
+
+	sv, err := NewSemanticVersion(versionString)
+	if err != nil {
+		return nil, err
+	}
+	return &WorkspaceVersion{raw: versionString, pinned: sv}, nil
+}
+
+// PinnedWorkspaceVersion returns WorkspaceVersion pinned to the version
+func PinnedWorkspaceVersion(s *SemanticVersion) *WorkspaceVersion {
+	return &WorkspaceVersion{raw: s.String(), pinned: s}
+}
+
+func (v *WorkspaceVersion) String() string {
+	return v.raw
+}
+
+// IsPinned returns whether the workspace is pinned to a version
+func (v *WorkspaceVersion) IsPinned() bool {
+	return v.pinned != nil
+}
+
+// IsLatest returns whether the workspace tracks the latest version
+func (v *WorkspaceVersion) IsLatest() bool {
+	return v.raw == latestWorkspaceVersion
+}
+
+// GetPinnedVersion returns the pinned version, or nil if the workspace is not pinned
+func (v *WorkspaceVersion) GetPinnedVersion() *SemanticVersion {
+	return v.pinned
+}
+
+// Resolve returns the version which the workspace currently runs with.
+// Terraform Cloud resolves "latest" and constraints to the newest release, excluding pre-releases.
+func (v *WorkspaceVersion) Resolve(releases []*TfRelease) (*SemanticVersion, error) {
+	if v.IsPinned() {
+		return v.pinned, nil
+	}
+
+	resolved := greatestRelease(releases, func(r *TfRelease) bool {
+		return isStableRelease(r) && (v.IsLatest() || v.constraint.CheckVersionConsistency(r.SemanticVersion))
+	})
+	if resolved == nil {
+		return nil, fmt.Errorf("No release matches the workspace version %s", v.raw)
+	}
+	return resolved, nil
+}
+
+// Equal returns whether both are the same setting. Pinned versions are compared as versions, like "v0.12.0" and "0.12.0".
+func (v *WorkspaceVersion) Equal(target *WorkspaceVersion) bool {
+	if v.IsPinned() && target.IsPinned() {
+		return v.pinned.Compare(target.pinned) == 0
+	}
+	return v.raw == target.raw
+}
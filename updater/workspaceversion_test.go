@@ -0,0 +1,143 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspaceVersion(t *testing.T) {
+	cases := []struct {
+		src      string
+		pinned   bool
+		latest   bool
+		resolved string
+		err      bool
+	}{
+		{src: "0.12.24", pinned: true, resolved: "0.12.24"},
+		{src: "latest", latest: true, resolved: "0.12.25"},
+		{src: "~> 0.12.0", resolved: "0.12.25"},
+		{src: ">= 0.12.0, < 0.12.24", resolved: "0.12.23"},
+		{src: "> 0.13.0", err: true},
+		{src: "~> latest", err: true},
+		{src: "1.5.x", err: true},
+	}
+
+	for _, v := range cases {
+		wv, err := NewWorkspaceVersion(v.src)
+		if err == nil {
+			if wv.IsPinned() != v.pinned || wv.IsLatest() != v.latest || wv.String() != v.src {
+				t.Errorf("Failed: src = %s / want pinned = %t, latest = %t / got = %t, %t, %s", v.src, v.pinned, v.latest, wv.IsPinned(), wv.IsLatest(), wv)
+			}
+			var resolved *SemanticVersion
+			if resolved, err = wv.Resolve(releases); err == nil && resolved.String() != v.resolved {
+				t.Errorf("Failed: src = %s / want = %s / got = %s", v.src, v.resolved, resolved)
+			}
+		}
+		if (err != nil) != v.err {
+			t.Errorf("Failed: src = %s / want error = %t / got = %v", v.src, v.err, err)
+		}
+		// the error on parsing must have the raw value
+		if parseErr, ok := err.(*VersionParseError); wv == nil && (!ok || parseErr.Raw != v.src) {
+			t.Errorf("Failed: src = %s / want = VersionParseError of %s / got = %v", v.src, v.src, err)
+		}
+	}
+}
+
+func TestSetWorkspaceVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfc-updater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &TfCloudMock{version: &SemanticVersion{Versions: []int{0, 12, 20}}}
+	w := &Workspace{
+		client:           client,
+		tfRelease:        &TfReleasesMock{},
+		requiredVersions: RequiredVersions{{Operator: "<", SemanticVersion: &SemanticVersion{Versions: []int{0, 12, 25}}}},
+		journal:          NewFileJournal(filepath.Join(dir, "journal.json")),
+	}
+
+	cases := []struct {
+		src      string
+		current  string
+		resolved string
+		err      bool
+	}{
+		// latest resolves to 0.12.25, which is not compatible
+		{src: "latest", current: "0.12.20", resolved: "0.12.20", err: true},
+		{src: "~> 0.12.0, < 0.12.24", current: "~> 0.12.0, < 0.12.24", resolved: "0.12.23"},
+		{src: "0.12.24", current: "0.12.24", resolved: "0.12.24"},
+	}
+
+	for _, v := range cases {
+		wv, err := NewWorkspaceVersion(v.src)
+		if err != nil {
+			t.Fatalf("Failed of error: %s", err)
+		}
+		if err = w.SetWorkspaceVersion(context.Background(), wv); (err != nil) != v.err {
+			t.Errorf("Failed: src = %s / want error = %t / got = %v", v.src, v.err, err)
+		}
+
+		current, err := w.GetWorkspaceVersion(context.Background())
+		if err != nil {
+			t.Fatalf("Failed of error: %s", err)
+		}
+		resolved, err := w.GetCurrentVersion(context.Background())
+		if err != nil {
+			t.Fatalf("Failed of error: %s", err)
+		}
+		if current.String() != v.current || resolved.String() != v.resolved {
+			t.Errorf("Failed: src = %s / want = %s (%s) / got = %s (%s)", v.src, v.current, v.resolved, current, resolved)
+		}
+	}
+
+	from, to, err := w.GetPreviousVersion()
+	if err != nil {
+		t.Fatalf("Failed of error: %s", err)
+	}
+	if from.String() != "~> 0.12.0, < 0.12.24" || to.String() != "0.12.24" {
+		t.Errorf("Failed: want = ~> 0.12.0, < 0.12.24 -> 0.12.24 / got = %s -> %s", from, to)
+	}
+}
+
+func TestResolveWorkspaceVersionPaginated(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.Write([]byte(`[{"tag_name": "v0.12.31"}, {"tag_name": "v0.12.30"}, {"tag_name": "v0.11.14"}]`))
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s/releases?per_page=100&page=2>; rel="next"`, r.Host))
+		// a patch of the old version is released after the newer ones
+		w.Write([]byte(`[{"tag_name": "v0.11.15"}, {"tag_name": "v0.13.0"}, {"tag_name": "v0.13.0-rc1"}]`))
+	}))
+	defer ts.Close()
+
+	w := &Workspace{tfRelease: &tfReleasesImpl{httpClient: http.DefaultClient, url: ts.URL + "/releases"}}
+	cases := []struct {
+		src      string
+		resolved string
+	}{
+		{src: "latest", resolved: "0.13.0"},
+		{src: "~> 0.12.0", resolved: "0.12.31"},
+		{src: "< 0.12.0", resolved: "0.11.15"},
+	}
+	for _, v := range cases {
+		wv, err := NewWorkspaceVersion(v.src)
+		if err != nil {
+			t.Fatalf("Failed of error: %s", err)
+		}
+		got, err := w.ResolveWorkspaceVersion(context.Background(), wv)
+		if err != nil {
+			t.Errorf("Failed of error: %s / src = %s", err, v.src)
+		} else if got.String() != v.resolved {
+			t.Errorf("Failed: src = %s / want = %s / got = %s", v.src, v.resolved, got)
+		}
+	}
+}